@@ -0,0 +1,95 @@
+package account
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrBadCredentials = errors.New("invalid account credentials")
+
+// Store of accounts clients log in to. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Check credentials and return the canonical account name.
+	Authenticate(name, password string) (string, error)
+}
+
+// Account entry of the accounts file.
+type Account struct {
+	Name     string `yaml:"name"`
+	Password string `yaml:"password"` // bcrypt hash
+}
+
+type accountsFile struct {
+	Accounts []Account `yaml:"accounts"`
+}
+
+// Default Store reading accounts with bcrypt hashed passwords from a YAML
+// file such as:
+//
+//	accounts:
+//	  - name: alice
+//	    password: $2a$10$...
+type FileStore struct {
+	accounts map[string]Account
+	path     string
+	mu       sync.RWMutex
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path}
+
+	err := store.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Read the accounts file again.
+func (f *FileStore) Reload() error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	parsed := accountsFile{}
+
+	err = yaml.Unmarshal(data, &parsed)
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[string]Account, len(parsed.Accounts))
+	for _, a := range parsed.Accounts {
+		accounts[strings.ToLower(a.Name)] = a
+	}
+
+	f.mu.Lock()
+	f.accounts = accounts
+	f.mu.Unlock()
+
+	return nil
+}
+
+func (f *FileStore) Authenticate(name, password string) (string, error) {
+	f.mu.RLock()
+	a, found := f.accounts[strings.ToLower(name)]
+	f.mu.RUnlock()
+
+	if !found {
+		return "", ErrBadCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(password)) != nil {
+		return "", ErrBadCredentials
+	}
+
+	return a.Name, nil
+}
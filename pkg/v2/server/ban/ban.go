@@ -0,0 +1,238 @@
+package ban
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/mask"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrBadMask = errors.New("invalid ban mask")
+
+// Server-wide ban. K-line masks are nick!user@host globs whose host part
+// may be a CIDR range, D-line masks are IP addresses or CIDR ranges.
+type Line struct {
+	Mask    string    `yaml:"mask"`
+	Reason  string    `yaml:"reason"`
+	SetBy   string    `yaml:"setBy"`
+	SetAt   time.Time `yaml:"setAt"`
+	Expires time.Time `yaml:"expires,omitempty"` // Zero for permanent bans
+}
+
+type linesFile struct {
+	KLines []Line `yaml:"klines"`
+	DLines []Line `yaml:"dlines"`
+}
+
+// K-lines and D-lines, saved to a YAML file after every change when the
+// file is set. Safe for concurrent use.
+type List struct {
+	klines []Line
+	dlines []Line
+	path   string
+	mu     sync.RWMutex
+}
+
+// Check whether the ban has expired by now.
+func (l *Line) Expired(now time.Time) bool {
+	return !l.Expires.IsZero() && !l.Expires.After(now)
+}
+
+// Open ban list saved in the file, which may not exist yet. Empty path
+// gives a list kept in memory only.
+func Open(path string) (*List, error) {
+	list := &List{path: path}
+	if path == "" {
+		return list, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := linesFile{}
+
+	err = yaml.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	list.klines = parsed.KLines
+	list.dlines = parsed.DLines
+
+	return list, nil
+}
+
+// Normalize K-line mask, so "*@host" becomes "*!*@host".
+func NormalizeKLine(m string) (string, error) {
+	if strings.ContainsAny(m, " ,") || !strings.Contains(m, "@") {
+		return "", ErrBadMask
+	}
+
+	return mask.Normalize(m), nil
+}
+
+// Normalize D-line mask, which is an IP address or CIDR range.
+func NormalizeDLine(m string) (string, error) {
+	if _, network, err := net.ParseCIDR(m); err == nil {
+		return network.String(), nil
+	}
+
+	if ip := net.ParseIP(m); ip != nil {
+		return ip.String(), nil
+	}
+
+	return "", ErrBadMask
+}
+
+// Add K-line, replacing the one with the same mask.
+func (l *List) AddKLine(line Line) error {
+	return l.add(&l.klines, line)
+}
+
+// Add D-line, replacing the one with the same mask.
+func (l *List) AddDLine(line Line) error {
+	return l.add(&l.dlines, line)
+}
+
+// Remove K-line, reporting whether it was there.
+func (l *List) RemoveKLine(m string) (bool, error) {
+	return l.remove(&l.klines, m)
+}
+
+// Remove D-line, reporting whether it was there.
+func (l *List) RemoveDLine(m string) (bool, error) {
+	return l.remove(&l.dlines, m)
+}
+
+// Find K-line matching nick!user@host of a client connected from ip.
+func (l *List) MatchKLine(nickname, username string, ip net.IP) (Line, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	prefix := nickname + "!" + username + "@"
+
+	for _, line := range l.klines {
+		if line.Expired(now) {
+			continue
+		}
+
+		userMask, host, _ := strings.Cut(line.Mask, "@")
+		if !mask.Match(userMask+"@", prefix) {
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(host); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return line, true
+			}
+
+			continue
+		}
+
+		if ip != nil && mask.Match(host, ip.String()) {
+			return line, true
+		}
+	}
+
+	return Line{}, false
+}
+
+// Find D-line matching ip.
+func (l *List) MatchDLine(ip net.IP) (Line, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+
+	for _, line := range l.dlines {
+		if line.Expired(now) {
+			continue
+		}
+
+		if _, network, err := net.ParseCIDR(line.Mask); err == nil {
+			if network.Contains(ip) {
+				return line, true
+			}
+
+			continue
+		}
+
+		if net.ParseIP(line.Mask).Equal(ip) {
+			return line, true
+		}
+	}
+
+	return Line{}, false
+}
+
+func (l *List) add(lines *[]Line, line Line) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := []Line{}
+
+	for _, existing := range *lines {
+		if !strings.EqualFold(existing.Mask, line.Mask) {
+			kept = append(kept, existing)
+		}
+	}
+
+	*lines = append(kept, line)
+
+	return l.save()
+}
+
+func (l *List) remove(lines *[]Line, m string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, existing := range *lines {
+		if strings.EqualFold(existing.Mask, m) {
+			*lines = append((*lines)[:i], (*lines)[i+1:]...)
+
+			return true, l.save()
+		}
+	}
+
+	return false, nil
+}
+
+// Write the list without expired lines to its file. Caller holds the lock.
+func (l *List) save() error {
+	now := time.Now()
+
+	for _, lines := range []*[]Line{&l.klines, &l.dlines} {
+		kept := []Line{}
+
+		for _, line := range *lines {
+			if !line.Expired(now) {
+				kept = append(kept, line)
+			}
+		}
+
+		*lines = kept
+	}
+
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := yaml.Marshal(linesFile{KLines: l.klines, DLines: l.dlines})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(l.path, data, 0o600)
+}
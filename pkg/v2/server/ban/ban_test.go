@@ -0,0 +1,162 @@
+package ban
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize func(string) (string, error)
+		mask      string
+		want      string
+		err       error
+	}{
+		{name: "K-line host only", normalize: NormalizeKLine, mask: "*@example.com", want: "*!*@example.com"},
+		{name: "K-line full", normalize: NormalizeKLine, mask: "a!b@192.0.2.0/24", want: "a!b@192.0.2.0/24"},
+		{name: "K-line without host", normalize: NormalizeKLine, mask: "alice", err: ErrBadMask},
+		{name: "K-line with space", normalize: NormalizeKLine, mask: "*@a b", err: ErrBadMask},
+		{name: "D-line address", normalize: NormalizeDLine, mask: "192.0.2.1", want: "192.0.2.1"},
+		{name: "D-line range", normalize: NormalizeDLine, mask: "192.0.2.77/24", want: "192.0.2.0/24"},
+		{name: "D-line IPv6 range", normalize: NormalizeDLine, mask: "2001:db8::1/64", want: "2001:db8::/64"},
+		{name: "D-line host name", normalize: NormalizeDLine, mask: "example.com", err: ErrBadMask},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.normalize(tt.mask)
+			require.ErrorIs(t, err, tt.err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchKLine(t *testing.T) {
+	list, err := Open("")
+	require.NoError(t, err)
+
+	for _, m := range []string{"*!*@192.0.2.0/24", "bad*!*@*", "*!evil@2001:db8::/64", "*!*@198.51.100.?"} {
+		require.NoError(t, list.AddKLine(Line{Mask: m, Reason: m}))
+	}
+
+	tests := []struct {
+		name     string
+		nickname string
+		username string
+		ip       string
+		want     string // Mask of the K-line matched, empty if none
+	}{
+		{name: "IPv4 range", nickname: "alice", username: "a", ip: "192.0.2.200", want: "*!*@192.0.2.0/24"},
+		{name: "outside IPv4 range", nickname: "alice", username: "a", ip: "192.0.3.1"},
+		{name: "nickname glob", nickname: "BadGuy", username: "a", ip: "203.0.113.1", want: "bad*!*@*"},
+		{name: "IPv6 range and username", nickname: "alice", username: "evil", ip: "2001:db8::42", want: "*!evil@2001:db8::/64"},
+		{name: "IPv6 range, other username", nickname: "alice", username: "good", ip: "2001:db8::42"},
+		{name: "host glob", nickname: "alice", username: "a", ip: "198.51.100.7", want: "*!*@198.51.100.?"},
+		{name: "host glob too short", nickname: "alice", username: "a", ip: "198.51.100.17"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, found := list.MatchKLine(tt.nickname, tt.username, net.ParseIP(tt.ip))
+			require.Equal(t, tt.want != "", found)
+			require.Equal(t, tt.want, line.Mask)
+		})
+	}
+}
+
+func TestMatchDLine(t *testing.T) {
+	list, err := Open("")
+	require.NoError(t, err)
+
+	for _, m := range []string{"192.0.2.0/24", "198.51.100.1", "2001:db8::/32"} {
+		require.NoError(t, list.AddDLine(Line{Mask: m}))
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "192.0.2.1", want: "192.0.2.0/24"},
+		{ip: "192.0.2.255", want: "192.0.2.0/24"},
+		{ip: "192.0.3.0"},
+		{ip: "198.51.100.1", want: "198.51.100.1"},
+		{ip: "198.51.100.2"},
+		{ip: "2001:db8:ffff::1", want: "2001:db8::/32"},
+		{ip: "2001:db9::1"},
+		// IPv4-mapped IPv6 addresses are IPv4 ones
+		{ip: "::ffff:192.0.2.1", want: "192.0.2.0/24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			line, found := list.MatchDLine(net.ParseIP(tt.ip))
+			require.Equal(t, tt.want != "", found)
+			require.Equal(t, tt.want, line.Mask)
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Now()
+
+	require.False(t, (&Line{}).Expired(now), "permanent")
+	require.False(t, (&Line{Expires: now.Add(time.Minute)}).Expired(now))
+	require.True(t, (&Line{Expires: now}).Expired(now))
+	require.True(t, (&Line{Expires: now.Add(-time.Minute)}).Expired(now))
+
+	list, err := Open("")
+	require.NoError(t, err)
+
+	require.NoError(t, list.AddDLine(Line{Mask: "192.0.2.1", Expires: now.Add(-time.Second)}))
+	require.NoError(t, list.AddKLine(Line{Mask: "*!*@192.0.2.1", Expires: now.Add(-time.Second)}))
+
+	_, found := list.MatchDLine(net.ParseIP("192.0.2.1"))
+	require.False(t, found)
+
+	_, found = list.MatchKLine("alice", "a", net.ParseIP("192.0.2.1"))
+	require.False(t, found)
+
+	// Expired lines are dropped with the next change
+	require.NoError(t, list.AddDLine(Line{Mask: "192.0.2.2"}))
+	require.Len(t, list.dlines, 1)
+	require.Empty(t, list.klines)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.yaml")
+
+	list, err := Open(path)
+	require.NoError(t, err, "missing file gives an empty list")
+
+	setAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, list.AddKLine(Line{Mask: "*!*@192.0.2.0/24", Reason: "spam", SetBy: "oper", SetAt: setAt}))
+	require.NoError(t, list.AddDLine(Line{Mask: "198.51.100.1", Reason: "flood", SetBy: "oper", SetAt: setAt, Expires: setAt.Add(24 * 365 * 100 * time.Hour)}))
+	require.NoError(t, list.AddDLine(Line{Mask: "198.51.100.2", Reason: "gone"}))
+
+	removed, err := list.RemoveDLine("198.51.100.2")
+	require.NoError(t, err)
+	require.True(t, removed)
+
+	removed, err = list.RemoveDLine("198.51.100.3")
+	require.NoError(t, err)
+	require.False(t, removed)
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+
+	require.Equal(t, list.klines, reopened.klines)
+	require.Equal(t, list.dlines, reopened.dlines)
+
+	line, found := reopened.MatchKLine("alice", "a", net.ParseIP("192.0.2.9"))
+	require.True(t, found)
+	require.Equal(t, "spam", line.Reason)
+
+	_, found = reopened.MatchDLine(net.ParseIP("198.51.100.2"))
+	require.False(t, found)
+}
@@ -0,0 +1,155 @@
+package caps
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	CapNotify = "cap-notify"
+
+	// CAP version from which values and multiline LS are understood
+	Version302 = 302
+)
+
+// Capability which can be negotiated by clients with CAP command.
+type Capability struct {
+	Name  string
+	Value string // Advertised only to clients speaking CAP 302
+}
+
+// Change of the registry reported to watchers.
+type Change struct {
+	Capability Capability
+	Added      bool
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Capability)
+	watchers []chan<- Change
+)
+
+func init() {
+	Register(CapNotify, "")
+}
+
+// Token of the capability as shown in CAP LS for the given CAP version.
+func (c Capability) Token(version int) string {
+	if c.Value == "" || version < Version302 {
+		return c.Name
+	}
+
+	return c.Name + "=" + c.Value
+}
+
+// Declare a capability so clients can request it. Subsystems call it for
+// every capability they implement, registering again updates the value.
+func Register(name, value string) {
+	c := Capability{Name: name, Value: value}
+
+	mu.Lock()
+	registry[name] = c
+	mu.Unlock()
+
+	notify(Change{Capability: c, Added: true})
+}
+
+// Withdraw a previously declared capability.
+func Unregister(name string) {
+	mu.Lock()
+	c, found := registry[name]
+	delete(registry, name)
+	mu.Unlock()
+
+	if found {
+		notify(Change{Capability: c, Added: false})
+	}
+}
+
+// Look up a declared capability by name.
+func Get(name string) (Capability, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, found := registry[name]
+
+	return c, found
+}
+
+// All declared capabilities sorted by name.
+func List() []Capability {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Capability, 0, len(registry))
+	for _, c := range registry {
+		list = append(list, c)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// Get notified about capabilities declared or withdrawn from now on.
+func Watch(ch chan<- Change) {
+	mu.Lock()
+	watchers = append(watchers, ch)
+	mu.Unlock()
+}
+
+func notify(change Change) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, ch := range watchers {
+		go func(ch chan<- Change) { ch <- change }(ch)
+	}
+}
+
+// Set of capabilities enabled by a single client. It is shared between
+// the server and room goroutines, hence guarded.
+type Set struct {
+	enabled map[string]bool
+	mu      sync.RWMutex
+}
+
+func NewSet() *Set {
+	return &Set{enabled: make(map[string]bool)}
+}
+
+// Check whether capability is enabled.
+func (s *Set) Has(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.enabled[name]
+}
+
+func (s *Set) Enable(name string) {
+	s.mu.Lock()
+	s.enabled[name] = true
+	s.mu.Unlock()
+}
+
+func (s *Set) Disable(name string) {
+	s.mu.Lock()
+	delete(s.enabled, name)
+	s.mu.Unlock()
+}
+
+// Names of enabled capabilities, sorted.
+func (s *Set) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.enabled))
+	for name := range s.enabled {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	CapAwayNotify = "away-notify"
+
+	AwayMaxLength = 390
+)
+
+func init() {
+	caps.Register(CapAwayNotify, "")
+}
+
+// Away message, empty when the client is not away.
+func (c *Client) AwayMessage() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.awayMessage
+}
+
+// Mark the client as away with the message, or back when it is empty.
+func (c *Client) SetAwayMessage(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.awayMessage = text
+}
+
+// Check whether the client is marked as away.
+func (c *Client) IsAway() bool {
+	return c.AwayMessage() != ""
+}
+
+// WHO reply flag, "G" (gone) for away clients and "H" (here) otherwise.
+func (c *Client) WhoFlag() string {
+	flag := "H"
+	if c.IsAway() {
+		flag = "G"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Operator {
+		flag += "*"
+	}
+
+	return flag
+}
+
+// Tell other client with away-notify about away status of this one.
+func (c *Client) SendAwayNotify(peer *Client) error {
+	if peer == c || !peer.Caps.Has(CapAwayNotify) {
+		return nil
+	}
+
+	msg := message.New(c.String(), "AWAY")
+	if c.IsAway() {
+		msg.Params = []string{c.AwayMessage()}
+	}
+
+	return peer.MsgTagged(message.Tags{}.WithTime(time.Now()), msg.String())
+}
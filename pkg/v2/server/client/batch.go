@@ -0,0 +1,42 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+)
+
+const (
+	CapBatch = "batch"
+)
+
+func init() {
+	caps.Register(CapBatch, "")
+}
+
+// Open a batch of the given type and return its reference. Empty reference
+// means the client did not negotiate batches and gets bare lines instead.
+func (c *Client) StartBatch(kind string, params ...string) (string, error) {
+	if !c.Caps.Has(CapBatch) {
+		return "", nil
+	}
+
+	ref := batchRef()
+
+	return ref, c.ReplyParts("BATCH", append([]string{"+" + ref, kind}, params...)...)
+}
+
+// New unique batch reference.
+func batchRef() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// Close the batch opened by StartBatch.
+func (c *Client) EndBatch(ref string) error {
+	if ref == "" {
+		return nil
+	}
+
+	return c.ReplyParts("BATCH", "-"+ref)
+}
@@ -3,13 +3,17 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/simplefxn/goircd/internal/pipeline"
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
 	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -18,27 +22,50 @@ import (
 const (
 	CRLF           = "\x0d\x0a"
 	BufSize        = 1380
+	LineMaxLength  = 512  // Max length of a line without tags, CRLF included
+	TagsMaxLength  = 8191 // Max length of tags, leading "@" and space included
+	BufMaxLength   = LineMaxLength + TagsMaxLength
 	PingTimeout    = time.Second * 180 // Max time deadline for client's unresponsiveness
 	PingThreashold = time.Second * 90  // Max idle client's time before PING are sent
 )
 
 type Client struct {
-	timestamp  time.Time
-	pipe       pipeline.Pipeline
-	conn       net.Conn
-	config     *config.Bootstrap
-	log        *zerolog.Logger
-	stop       chan bool
-	events     chan Event
-	name       string
-	hostname   string
-	RemoteHost string
-	Nickname   string
-	Username   string
-	Realname   string
-	isStarted  bool
-	pingSent   bool
-	Registered bool
+	timestamp time.Time
+	pipe      pipeline.Pipeline
+	conn      net.Conn
+	config    *config.Bootstrap
+	log       *zerolog.Logger
+	stop      chan bool // Closed once the connection is gone
+	events    chan Event
+	mu        sync.Mutex // Guards response, sendq, closeReason, operator status and what rooms read
+	response  *Response
+	sendq     sendQueue
+	flushed   chan struct{} // Closed once the writer is done
+	inbox     chan pending  // Commands read, waiting for the dispatcher
+	class     config.Class
+	floodFull time.Time // Flood control bucket is full again by then
+	// Why the server closed the connection, if it did
+	closeReason string
+	Caps        *caps.Set
+	name        string
+	hostname    string
+	RemoteHost  string
+	nickname    string
+	Username    string
+	Realname    string
+	Account     string // Account logged in to, empty if none
+	// Away message, empty when client is not away
+	awayMessage string
+	invisible   bool     // Hidden from those not sharing a room, user mode +i
+	Wallops     bool     // Receives WALLOPS, user mode +w
+	Operator    bool     // Server operator, user mode +o
+	Privileges  []string // Granted by the operator block
+	CapVersion  int
+	isStarted   bool
+	pingSent    bool
+	Registered  bool
+	// Registration is held back while capabilities are negotiated
+	Negotiating bool
 }
 
 type Option func(o *Client)
@@ -75,15 +102,61 @@ func (c *Client) Name() string {
 	return c.name
 }
 
+// Current nickname, "*" until one is chosen. Rooms read it while the
+// server changes it, hence the lock.
+func (c *Client) Nickname() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.nickname
+}
+
+func (c *Client) SetNickname(nickname string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nickname = nickname
+}
+
 func (c *Client) String() string {
-	return c.Nickname + "!" + c.Username + "@" + c.conn.RemoteAddr().String()
+	return c.Nickname() + "!" + c.Username + "@" + c.Host()
+}
+
+// Verified certificate presented by the client over TLS, nil if none.
+func (c *Client) Certificate() *x509.Certificate {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// Remote host without port, as shown in nick!user@host prefixes.
+func (c *Client) Host() string {
+	host, _, err := net.SplitHostPort(c.RemoteHost)
+	if err != nil {
+		return c.RemoteHost
+	}
+
+	return host
 }
 
 func New(opts ...Option) (*Client, error) {
 	var logger zerolog.Logger
 
 	proc := &Client{
-		stop: make(chan bool),
+		stop:     make(chan bool),
+		sendq:    sendQueue{wake: make(chan struct{}, 1)},
+		flushed:  make(chan struct{}),
+		inbox:    make(chan pending, InboxSize),
+		Caps:     caps.NewSet(),
+		nickname: "*",
 	}
 
 	for _, o := range opts {
@@ -111,94 +184,185 @@ func New(opts ...Option) (*Client, error) {
 	}
 
 	proc.RemoteHost = proc.conn.RemoteAddr().String()
+	proc.class = proc.config.Class(net.ParseIP(proc.Host()))
 
 	return proc, nil
 }
 
 func (c *Client) Start(ctx context.Context) {
-	var bufNet []byte
-
 	c.isStarted = true
-	buf := make([]byte, 0)
+
+	go c.writer()
+	go c.dispatcher()
 
 	go func() {
 		c.log.Info().Dict("details", zerolog.Dict().Str("client", c.RemoteHost)).Msg("started")
 		// Create new event for this client
 		c.events <- Event{
 			EventType: EventNew,
-			Text:      "",
 			Client:    c,
 		}
 
-		for {
-			bufNet = make([]byte, BufSize)
+		bufNet := make([]byte, BufSize)
+		buf := []byte{}
+		// Line which outgrew the buffer is thrown away up to its very end
+		discarding := false
 
-			_, err := c.conn.Read(bufNet)
+		for {
+			n, err := c.conn.Read(bufNet)
 			if err != nil {
 				c.log.Err(err).Msg("connection lost")
+				close(c.stop)
+				close(c.inbox)
+
 				return
 			}
 
 			c.timestamp = time.Now()
 			c.pingSent = false
-			bufNet = bytes.TrimRight(bufNet, "\x00")
-			c.log.Debug().Dict("details", zerolog.Dict().Bytes("bytes", bufNet)).Msg("received")
+			c.log.Debug().Dict("details", zerolog.Dict().Bytes("bytes", bufNet[:n])).Msg("received")
 
-			buf = append(buf, bufNet...)
-			if !bytes.HasSuffix(buf, []byte(CRLF)) {
-				continue
-			}
+			buf = append(buf, bufNet[:n]...)
 
-			for _, msg := range bytes.Split(buf[:len(buf)-2], []byte(CRLF)) {
-				if len(msg) > 0 {
-					c.events <- Event{c, string(msg), EventMsg}
+			for {
+				end := bytes.IndexByte(buf, '\n')
+				if end < 0 {
+					break
 				}
+
+				line := buf[:end]
+				buf = buf[end+1:]
+
+				if discarding {
+					discarding = false
+
+					continue
+				}
+
+				c.dispatch(line)
 			}
 
-			buf = []byte{}
+			if len(buf) > BufMaxLength {
+				if !discarding {
+					err = c.ReplyInputTooLong()
+					if err != nil {
+						c.log.Err(err).Msg("cannot send message")
+					}
+				}
+
+				discarding = true
+				buf = buf[:0]
+			}
 		}
 	}()
 }
 
+// Pass a line, with or without CR, to the server as a message, subject to
+// flood control. Blank lines are silently ignored, too long ones are refused.
+// CR has no place inside a message, stray ones are dropped.
+func (c *Client) dispatch(line []byte) {
+	line = bytes.ReplaceAll(line, []byte("\r"), nil)
+
+	tags := 0
+	if len(line) > 0 && line[0] == '@' {
+		tags = bytes.IndexByte(line, ' ') + 1
+		if tags == 0 {
+			tags = len(line)
+		}
+	}
+
+	if tags > TagsMaxLength || len(line)-tags+len(CRLF) > LineMaxLength {
+		err := c.ReplyInputTooLong()
+		if err != nil {
+			c.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	msg, err := message.Parse(string(line))
+	if err != nil {
+		return
+	}
+
+	c.schedule(msg)
+}
+
 func (c *Client) Stop(ctx context.Context) error {
 	if c.isStarted {
 		c.isStarted = false
 
-		err := c.conn.Close()
-		if err != nil {
-			c.log.Err(err).Msg("closing connection")
-		}
+		// Whatever was sent before, e.g. ERROR, still gets through
+		c.closeQueue()
 		c.log.Debug().Dict("details", zerolog.Dict()).Msg("stopped")
 	}
 
 	return nil
 }
 
-// Send message as is with CRLF appended.
+// Send message as is with CRLF appended. It is only queued, so slow
+// clients never hold the sender up.
 func (c *Client) Msg(text string) error {
-	_, err := c.conn.Write([]byte(text + CRLF))
-	return err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enqueue(text + CRLF)
+
+	return nil
+}
+
+// Send message in response to the command of the client being handled.
+// It is collected for the labelled response while there is one, other
+// traffic sent meanwhile with Msg goes out as usual.
+func (c *Client) Respond(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.response != nil {
+		c.collect(text)
+
+		return nil
+	}
+
+	c.enqueue(text + CRLF)
+
+	return nil
+}
+
+// Channel closed once whatever was queued before Stop is written, or the
+// connection failed.
+func (c *Client) Flushed() <-chan struct{} {
+	return c.flushed
+}
+
+// Reason the server closed the connection for, "Connection closed" if
+// the client went away by itself.
+func (c *Client) CloseReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeReason == "" {
+		return "Connection closed"
+	}
+
+	return c.closeReason
 }
 
 // Send message from server. It has ": servername" prefix.
 func (c *Client) Reply(text string) error {
-	return c.Msg(":" + c.hostname + " " + text)
+	return c.Respond(":" + c.hostname + " " + text)
 }
 
-// Send server message, concatenating all provided text parts and
-// prefix the last one with ":".
+// Send server message with the text parts as its parameters. The last one
+// is sent as trailing parameter when it has to.
 func (c *Client) ReplyParts(code string, text ...string) error {
-	parts := []string{code}
-	parts = append(parts, text...)
-	parts[len(parts)-1] = ":" + parts[len(parts)-1]
-
-	return c.Reply(strings.Join(parts, " "))
+	return c.Respond(message.New(c.hostname, code, text...).String())
 }
 
 // Send nicknamed server message. After servername it always has target
-// client's nickname. The last part is prefixed with ":".
+// client's nickname.
 func (c *Client) ReplyNicknamed(code string, text ...string) error {
-	return c.ReplyParts(code, append([]string{c.Nickname}, text...)...)
+	return c.ReplyParts(code, append([]string{c.Nickname()}, text...)...)
 }
 
 // Reply "461 not enough parameters" error for given command.
@@ -215,6 +379,22 @@ func (c *Client) ReplyNoNickChan(channel string) error {
 	return c.ReplyNicknamed("401", channel, "No such nick/channel")
 }
 
+// Reply "417 input line too long" error. The line never reaches the
+// server, so this is no part of the response to whatever it handles.
+func (c *Client) ReplyInputTooLong() error {
+	return c.Msg(message.New(c.hostname, "417", c.Nickname(), "Input line too long").String())
+}
+
+// Reply "442 not on channel" error for specified channel.
+func (c *Client) ReplyNotOnChannel(channel string) error {
+	return c.ReplyNicknamed("442", channel, "You are not on that channel")
+}
+
+// Reply "482 not channel operator" error for specified channel.
+func (c *Client) ReplyChanOpPrivsNeeded(channel string) error {
+	return c.ReplyNicknamed("482", channel, "You're not channel operator")
+}
+
 func (c *Client) SendPing(now time.Time) error {
 	if c.timestamp.Add(PingTimeout).Before(now) {
 		log.Info().Msg("ping timeout")
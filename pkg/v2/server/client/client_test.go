@@ -0,0 +1,200 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Started client whose input is written to the returned connection and
+// output read from the reader. Events the client sends, EventNew aside,
+// arrive on the returned channel.
+func newTestClient(t *testing.T, cfg *config.Bootstrap) (*Client, chan Event, net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	local, remote := net.Pipe()
+	events := make(chan Event, 16)
+
+	cli, err := New(
+		Config(cfg),
+		Logger(&logger),
+		Hostname("irc.test"),
+		Connection(local),
+		Events(events),
+	)
+	require.NoError(t, err)
+
+	cli.Start(context.Background())
+
+	ev := <-events
+	require.Equal(t, EventNew, ev.EventType)
+
+	t.Cleanup(func() {
+		remote.Close()
+		local.Close()
+	})
+
+	return cli, events, remote, bufio.NewReader(remote)
+}
+
+func TestLineFraming(t *testing.T) {
+	tooLong := ":irc.test 417 * :Input line too long\r\n"
+
+	tests := []struct {
+		name     string
+		input    string
+		messages []string // Messages passed to the server
+		replies  []string // Lines sent back
+	}{
+		{
+			name:     "CRLF and LF terminated",
+			input:    "PING a\r\nPING b\n",
+			messages: []string{"PING a", "PING b"},
+		},
+		{
+			name:     "blank lines",
+			input:    "\r\n\n\r\nPING a\r\n",
+			messages: []string{"PING a"},
+		},
+		{
+			name:     "lone CR inside a line",
+			input:    "PING :a\rb\r\n",
+			messages: []string{"PING ab"},
+		},
+		{
+			name:     "longest body",
+			input:    "PING " + strings.Repeat("a", 505) + "\r\n",
+			messages: []string{"PING " + strings.Repeat("a", 505)},
+		},
+		{
+			name:     "body too long",
+			input:    "PING " + strings.Repeat("a", 506) + "\r\nPING b\r\n",
+			messages: []string{"PING b"},
+			replies:  []string{tooLong},
+		},
+		{
+			name:     "longest tags",
+			input:    "@a=" + strings.Repeat("b", 8187) + " PING c\r\n",
+			messages: []string{"@a=" + strings.Repeat("b", 8187) + " PING c"},
+		},
+		{
+			name:     "tags too long",
+			input:    "@a=" + strings.Repeat("b", 8188) + " PING c\r\nPING d\r\n",
+			messages: []string{"PING d"},
+			replies:  []string{tooLong},
+		},
+		{
+			name:     "overlong line discarded up to its end",
+			input:    "PING " + strings.Repeat("a", 3*BufMaxLength) + "\r\nPING b\r\n",
+			messages: []string{"PING b"},
+			replies:  []string{tooLong},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, events, conn, out := newTestClient(t, &config.Bootstrap{})
+
+			go func() {
+				_, _ = conn.Write([]byte(tt.input))
+			}()
+
+			for _, want := range tt.messages {
+				select {
+				case ev := <-events:
+					expected, err := message.Parse(want)
+					require.NoError(t, err)
+					require.Equal(t, EventMsg, ev.EventType)
+					require.Equal(t, expected, ev.Message)
+				case <-time.After(time.Second):
+					t.Fatalf("message %q not passed", want)
+				}
+			}
+
+			var replies []string
+
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+
+			for {
+				line, err := out.ReadString('\n')
+				if err != nil {
+					break
+				}
+
+				replies = append(replies, line)
+			}
+
+			require.Equal(t, tt.replies, replies)
+		})
+	}
+}
+
+// Connection telling when it gets closed.
+type closeRecorder struct {
+	net.Conn
+	closed chan struct{}
+}
+
+func (c *closeRecorder) Close() error {
+	close(c.closed)
+
+	return c.Conn.Close()
+}
+
+func TestWriterClosesConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(t *testing.T, cli *Client, remote net.Conn)
+	}{
+		{
+			name: "server stops the client",
+			close: func(t *testing.T, cli *Client, remote net.Conn) {
+				require.NoError(t, cli.Stop(context.Background()))
+			},
+		},
+		{
+			name: "client goes away",
+			close: func(t *testing.T, cli *Client, remote net.Conn) {
+				require.NoError(t, remote.Close())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := zerolog.Nop()
+			local, remote := net.Pipe()
+			conn := &closeRecorder{Conn: local, closed: make(chan struct{})}
+
+			cli, err := New(
+				Config(&config.Bootstrap{}),
+				Logger(&logger),
+				Connection(conn),
+				Events(make(chan Event, 16)),
+			)
+			require.NoError(t, err)
+
+			cli.Start(context.Background())
+
+			tt.close(t, cli, remote)
+
+			select {
+			case <-conn.closed:
+			case <-time.After(time.Second):
+				t.Fatal("connection not closed")
+			}
+
+			<-cli.Flushed()
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package client
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
 
 type EventType int
 
@@ -11,11 +15,17 @@ const (
 	EventWho
 	EventMode
 	EventMsg
+	EventKick
+	EventInvite
+	EventNames
+	EventQuit
+	EventSync // Sent only to wait until previous events are handled
 )
 
 type Event struct {
 	Client    *Client
-	Text      string
+	Target    *Client         // Client the event is about, e.g. the invited one
+	Message   message.Message // Command sent by the client, if any
 	EventType EventType
 }
 
@@ -33,6 +43,16 @@ func (e EventType) String() string {
 		return "WHO"
 	case EventMsg:
 		return "MSG"
+	case EventKick:
+		return "KICK"
+	case EventInvite:
+		return "INVITE"
+	case EventNames:
+		return "NAMES"
+	case EventQuit:
+		return "QUIT"
+	case EventSync:
+		return "SYNC"
 	default:
 		return fmt.Sprintf("%d", int(e))
 	}
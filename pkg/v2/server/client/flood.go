@@ -0,0 +1,139 @@
+package client
+
+import (
+	"strings"
+	"time"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	FloodDefaultBurst  = 10               // Commands sent at once before delays start, unless configured
+	FloodDefaultRate   = 2                // Commands per second in the long run, unless configured
+	FloodDefaultMaxLag = 10 * time.Second // Delay which gets the client disconnected, unless configured
+	FloodDefaultCost   = 1
+
+	InboxSize = 64 // Commands waiting for the dispatcher before reading stops
+)
+
+// Flood control cost of commands differing from FloodDefaultCost. Those
+// answered with many lines cost more, keeping the connection alive is free.
+// AUTHENTICATE and OPER make the server check a password, they cost more too.
+var FloodCosts = map[string]float64{
+	"CAP":          0,
+	"PING":         0,
+	"PONG":         0,
+	"QUIT":         0,
+	"AUTHENTICATE": 2,
+	"CHATHISTORY":  2,
+	"JOIN":         2,
+	"NAMES":        2,
+	"WHOIS":        2,
+	"WHO":          3,
+	"LIST":         5,
+	"OPER":         5,
+}
+
+// Command read from the client together with the time flood control
+// lets it through.
+type pending struct {
+	msg message.Message
+	due time.Time
+}
+
+// Token bucket limits of the client class, defaults filled in.
+func (c *Client) floodLimits() (burst, rate float64, maxLag time.Duration) {
+	burst, rate, maxLag = c.class.Flood.Burst, c.class.Flood.Rate, c.class.Flood.MaxLag
+
+	if burst <= 0 {
+		burst = FloodDefaultBurst
+	}
+
+	if rate <= 0 {
+		rate = FloodDefaultRate
+	}
+
+	if maxLag <= 0 {
+		maxLag = FloodDefaultMaxLag
+	}
+
+	return burst, rate, maxLag
+}
+
+// Charge the command to the token bucket of the client and tell when it
+// may be handled. Tokens are tracked as the time the bucket is full again,
+// commands are delayed once more than burst tokens are spent. False means
+// the client lags behind more than its class allows.
+func (c *Client) floodDue(command string, now time.Time) (time.Time, bool) {
+	if c.class.Exempt || c.Privileged(config.PrivilegeFlood) {
+		return now, true
+	}
+
+	cost, found := FloodCosts[command]
+	if !found {
+		cost = FloodDefaultCost
+	}
+
+	burst, rate, maxLag := c.floodLimits()
+
+	if c.floodFull.Before(now) {
+		c.floodFull = now
+	}
+
+	c.floodFull = c.floodFull.Add(time.Duration(cost / rate * float64(time.Second)))
+
+	due := c.floodFull.Add(-time.Duration(burst / rate * float64(time.Second)))
+	if due.Before(now) {
+		due = now
+	}
+
+	return due, due.Sub(now) <= maxLag
+}
+
+// Queue the message for the dispatcher, disconnecting the client with
+// "Excess Flood" when it sends faster than flood control lets it.
+func (c *Client) schedule(msg message.Message) {
+	due, ok := c.floodDue(strings.ToUpper(msg.Command), time.Now())
+	if !ok {
+		c.mu.Lock()
+		if !c.sendq.closing {
+			c.log.Info().Str("client", c.RemoteHost).Msg("excess flood")
+			c.abort("Excess Flood")
+		}
+		c.mu.Unlock()
+
+		return
+	}
+
+	c.inbox <- pending{msg: msg, due: due}
+}
+
+// Pass queued messages to the server once they are due. Nothing is passed
+// once the server closes the connection. The server is told the client is
+// gone only after everything it sent before is handled.
+func (c *Client) dispatcher() {
+	for p := range c.inbox {
+		c.mu.Lock()
+		closing := c.sendq.closing
+		c.mu.Unlock()
+
+		if closing {
+			continue
+		}
+
+		if wait := time.Until(p.due); wait > 0 {
+			timer := time.NewTimer(wait)
+
+			select {
+			case <-timer.C:
+			case <-c.stop:
+				timer.Stop()
+			}
+		}
+
+		c.events <- Event{Client: c, Message: p.msg, EventType: EventMsg}
+	}
+
+	c.events <- Event{Client: c, EventType: EventDel}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	CapLabeledResponse = "labeled-response"
+)
+
+func init() {
+	caps.Register(CapLabeledResponse, "")
+}
+
+// Lines sent in response to a labelled command, held back until the
+// command is handled completely.
+type Response struct {
+	label string
+	lines []string
+	size  int
+}
+
+// Start collecting what is sent to the client with Respond as the response
+// to the command labelled so. Nothing is collected, and false is returned, unless
+// the label is set and the client negotiated labeled-response.
+func (c *Client) StartLabel(label string) bool {
+	if label == "" || !c.Caps.Has(CapLabeledResponse) {
+		return false
+	}
+
+	c.mu.Lock()
+	c.response = &Response{label: label}
+	c.mu.Unlock()
+
+	return true
+}
+
+// Take the response of the labelled command being handled, nil if none.
+// Nothing is collected until it is resumed, so a command waiting for slow
+// work does not get its response completed without the result.
+func (c *Client) SuspendLabel() *Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rsp := c.response
+	c.response = nil
+
+	return rsp
+}
+
+// Go on collecting the response taken by SuspendLabel.
+func (c *Client) ResumeLabel(rsp *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.response = rsp
+}
+
+// Collect line for the response. Collected lines count against the SendQ
+// limit just like queued ones do. Caller holds c.mu.
+func (c *Client) collect(line string) {
+	if c.sendq.closing {
+		return
+	}
+
+	c.response.size += len(line) + len(CRLF)
+	if c.sendq.size+c.response.size > c.sendQLimit() {
+		c.log.Info().Str("client", c.RemoteHost).Int("collected", c.response.size).Msg("SendQ exceeded")
+		c.response.lines = nil
+		c.abort("SendQ exceeded")
+
+		return
+	}
+
+	c.response.lines = append(c.response.lines, line)
+}
+
+// Send the collected response: no lines at all are acknowledged with ACK,
+// single line gets the label tag, more lines are wrapped in a
+// labeled-response batch. Clients without batch get them unlabelled.
+func (c *Client) EndLabel() error {
+	c.mu.Lock()
+	rsp := c.response
+	c.response = nil
+	c.mu.Unlock()
+
+	if rsp == nil {
+		return nil
+	}
+
+	label := message.Tags{message.TagLabel: rsp.label}
+
+	switch {
+	case len(rsp.lines) == 0:
+		return c.Msg(message.Message{Tags: label, Source: c.hostname, Command: "ACK"}.String())
+	case len(rsp.lines) == 1:
+		return c.Msg(tagLine(rsp.lines[0], message.TagLabel, rsp.label))
+	case !c.Caps.Has(CapBatch):
+		for _, line := range rsp.lines {
+			err := c.Msg(line)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	ref := batchRef()
+
+	err := c.Msg(message.Message{Tags: label, Source: c.hostname, Command: "BATCH", Params: []string{"+" + ref, "labeled-response"}}.String())
+	if err != nil {
+		return err
+	}
+
+	for _, line := range rsp.lines {
+		// Lines of nested batches stay in their own batch
+		if msg, parseErr := message.Parse(line); parseErr == nil {
+			if _, nested := msg.Tags[message.TagBatch]; !nested {
+				msg.Tags[message.TagBatch] = ref
+				line = msg.String()
+			}
+		}
+
+		err = c.Msg(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.EndBatch(ref)
+}
+
+// Line with the tag set. Lines which fail to parse are left as they are.
+func tagLine(line, key, value string) string {
+	msg, err := message.Parse(line)
+	if err != nil {
+		return line
+	}
+
+	msg.Tags = msg.Tags.With(key, value)
+
+	return msg.String()
+}
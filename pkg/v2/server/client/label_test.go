@@ -0,0 +1,49 @@
+package client
+
+import (
+	"testing"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelCollectsResponseOnly(t *testing.T) {
+	cli, _, _, out := newTestClient(t, &config.Bootstrap{})
+	cli.Caps.Enable(CapLabeledResponse)
+
+	require.True(t, cli.StartLabel("abc"))
+
+	// Traffic of others is not held back by the labelled command
+	require.NoError(t, cli.Msg(":bob!b@host PRIVMSG #room :hello"))
+	require.NoError(t, cli.ReplyParts("PONG", "irc.test", "x"))
+
+	line, err := out.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ":bob!b@host PRIVMSG #room :hello\r\n", line)
+
+	require.NoError(t, cli.EndLabel())
+
+	line, err = out.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "@label=abc :irc.test PONG irc.test x\r\n", line)
+}
+
+func TestLabelCountsAgainstSendQ(t *testing.T) {
+	cfg := &config.Bootstrap{}
+	cfg.SendQ.Size = 64
+
+	cli, _, _, out := newTestClient(t, cfg)
+	cli.Caps.Enable(CapLabeledResponse)
+
+	require.True(t, cli.StartLabel("abc"))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, cli.ReplyParts("NOTICE", "*", "some long enough notice"))
+	}
+
+	line, err := out.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "ERROR :SendQ exceeded\r\n", line)
+	require.Equal(t, "SendQ exceeded", cli.CloseReason())
+}
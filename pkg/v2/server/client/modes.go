@@ -0,0 +1,85 @@
+package client
+
+// User modes. Operator is granted by the server only and registered
+// reflects the account logged in to.
+const (
+	UserModeInvisible  = 'i'
+	UserModeOperator   = 'o'
+	UserModeRegistered = 'r'
+	UserModeWallops    = 'w'
+
+	UserModes = "iorw"
+)
+
+// Check whether a user mode is set.
+func (c *Client) UserMode(mode rune) bool {
+	switch mode {
+	case UserModeInvisible:
+		return c.Invisible()
+	case UserModeOperator:
+		return c.Operator
+	case UserModeRegistered:
+		return c.Account != ""
+	case UserModeWallops:
+		return c.Wallops
+	default:
+		return false
+	}
+}
+
+// Check whether the client is hidden from those not sharing a room with
+// it, user mode +i. Rooms look at it too, hence the lock.
+func (c *Client) Invisible() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.invisible
+}
+
+func (c *Client) SetInvisible(invisible bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invisible = invisible
+}
+
+// Grant or revoke operator status along with its privileges. They are
+// looked at by flood control too, hence the lock.
+func (c *Client) SetOperator(operator bool, privileges []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Operator = operator
+	c.Privileges = privileges
+}
+
+// Check whether the client is an operator granted the privilege.
+func (c *Client) Privileged(privilege string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.Operator {
+		return false
+	}
+
+	for _, p := range c.Privileges {
+		if p == privilege {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Current user modes as sent in 221 reply.
+func (c *Client) UserModes() string {
+	modes := "+"
+
+	for _, mode := range UserModes {
+		if c.UserMode(mode) {
+			modes += string(mode)
+		}
+	}
+
+	return modes
+}
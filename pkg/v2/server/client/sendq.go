@@ -0,0 +1,139 @@
+package client
+
+import "time"
+
+const (
+	SendQDefaultSize    = 64 * 1024        // Bytes queued for a client unless configured
+	WriteDefaultTimeout = 30 * time.Second // Time a single write may take unless configured
+	WriteCloseTimeout   = time.Second      // Time left for the final ERROR to a slow client
+)
+
+// Lines waiting to be written to the connection by the writer goroutine,
+// so that no sender ever waits for a slow client.
+type sendQueue struct {
+	lines   [][]byte
+	size    int // Bytes queued or still being written
+	wake    chan struct{}
+	closing bool // Connection is closed once queued lines are written
+}
+
+// Queue line for sending. Client whose queue is full is disconnected, it
+// gets nothing but ERROR. That is no error of the sender, which must not
+// be bothered by slow clients. Caller holds c.mu.
+func (c *Client) enqueue(line string) {
+	if c.sendq.closing {
+		return
+	}
+
+	if c.sendq.size+len(line) > c.sendQLimit() {
+		c.log.Info().Str("client", c.RemoteHost).Int("queued", c.sendq.size).Msg("SendQ exceeded")
+		c.abort("SendQ exceeded")
+
+		return
+	}
+
+	c.sendq.lines = append(c.sendq.lines, []byte(line))
+	c.sendq.size += len(line)
+	c.wakeWriter()
+}
+
+// Bytes which may be queued for the client.
+func (c *Client) sendQLimit() int {
+	if c.config.SendQ.Size > 0 {
+		return c.config.SendQ.Size
+	}
+
+	return SendQDefaultSize
+}
+
+// Drop everything queued and close the connection right after telling the
+// client why with ERROR. Caller holds c.mu.
+func (c *Client) abort(reason string) {
+	c.closeReason = reason
+	c.sendq.lines = [][]byte{[]byte("ERROR :" + reason + CRLF)}
+	c.sendq.closing = true
+	c.wakeWriter()
+
+	// Cut short the write the writer may be stuck in
+	err := c.conn.SetWriteDeadline(time.Now().Add(WriteCloseTimeout))
+	if err != nil {
+		c.log.Err(err).Msg("cannot set write deadline")
+	}
+}
+
+// Close the connection as soon as everything queued is written.
+func (c *Client) closeQueue() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sendq.closing = true
+	c.wakeWriter()
+}
+
+// Caller holds c.mu.
+func (c *Client) wakeWriter() {
+	select {
+	case c.sendq.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Write queued lines until the connection is closed or fails. Each write
+// has a deadline, so a stalled client is dropped instead of holding its
+// lines forever. The connection is closed whatever way the writer exits.
+func (c *Client) writer() {
+	defer close(c.flushed)
+
+	defer func() {
+		err := c.conn.Close()
+		if err != nil {
+			c.log.Err(err).Msg("closing connection")
+		}
+	}()
+
+	for {
+		select {
+		case <-c.sendq.wake:
+		case <-c.stop:
+			return
+		}
+
+		// Lines taken still count against the limit until they are written
+		c.mu.Lock()
+		lines, closing := c.sendq.lines, c.sendq.closing
+		c.sendq.lines = nil
+		c.mu.Unlock()
+
+		timeout := c.config.SendQ.WriteTimeout
+		if timeout <= 0 {
+			timeout = WriteDefaultTimeout
+		}
+
+		if closing && timeout > WriteCloseTimeout {
+			timeout = WriteCloseTimeout
+		}
+
+		for _, line := range lines {
+			err := c.conn.SetWriteDeadline(time.Now().Add(timeout))
+			if err == nil {
+				_, err = c.conn.Write(line)
+			}
+
+			if err != nil {
+				c.log.Err(err).Msg("cannot write to connection")
+
+				closing = true
+
+				break
+			}
+
+			c.mu.Lock()
+			c.sendq.size -= len(line)
+			c.mu.Unlock()
+		}
+
+		if closing {
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendQLimit(t *testing.T) {
+	line := strings.Repeat("a", 58) // 60 bytes with CRLF
+
+	tests := []struct {
+		name   string
+		read   bool // Client reads what it is sent
+		reason string
+	}{
+		{name: "client keeps up", read: true, reason: "Connection closed"},
+		// First line is stuck in the write, it still counts
+		{name: "writer blocked", read: false, reason: "SendQ exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Bootstrap{}
+			cfg.SendQ.Size = 100
+
+			cli, _, _, out := newTestClient(t, cfg)
+
+			require.NoError(t, cli.Msg(line))
+
+			// Wait for the writer to take the line
+			require.Eventually(t, func() bool {
+				cli.mu.Lock()
+				defer cli.mu.Unlock()
+
+				return len(cli.sendq.lines) == 0
+			}, time.Second, time.Millisecond)
+
+			if tt.read {
+				_, err := out.ReadString('\n')
+				require.NoError(t, err)
+
+				require.Eventually(t, func() bool {
+					cli.mu.Lock()
+					defer cli.mu.Unlock()
+
+					return cli.sendq.size == 0
+				}, time.Second, time.Millisecond)
+			}
+
+			require.NoError(t, cli.Msg(line))
+			require.Equal(t, tt.reason, cli.CloseReason())
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	CapMessageTags = "message-tags"
+	CapServerTime  = "server-time"
+	CapEchoMessage = "echo-message"
+)
+
+func init() {
+	caps.Register(CapMessageTags, "")
+	caps.Register(CapServerTime, "")
+	caps.Register(CapEchoMessage, "")
+}
+
+// Tags the client may receive according to its negotiated capabilities.
+func (c *Client) filterTags(tags message.Tags) message.Tags {
+	allowed := message.Tags{}
+
+	for k, v := range tags {
+		switch {
+		case k == message.TagTime && c.Caps.Has(CapServerTime):
+			allowed[k] = v
+		case k == message.TagBatch && c.Caps.Has(CapBatch):
+			allowed[k] = v
+		case k != message.TagBatch && c.Caps.Has(CapMessageTags):
+			allowed[k] = v
+		}
+	}
+
+	return allowed
+}
+
+// Send message prefixed with those tags the client negotiated.
+func (c *Client) MsgTagged(tags message.Tags, text string) error {
+	return c.Msg(c.filterTags(tags).String() + text)
+}
+
+// Send message prefixed with those tags the client negotiated, in
+// response to its command. See Respond.
+func (c *Client) RespondTagged(tags message.Tags, text string) error {
+	return c.Respond(c.filterTags(tags).String() + text)
+}
+
+// Send client's own message back to it if it negotiated echo-message.
+func (c *Client) Echo(tags message.Tags, text string) error {
+	if !c.Caps.Has(CapEchoMessage) {
+		return nil
+	}
+
+	return c.RespondTagged(tags, text)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	CertMatchCN          = "cn"
+	CertMatchFingerprint = "fingerprint"
+)
+
+// Rules mapping verified TLS client certificates to accounts, used by
+// SASL EXTERNAL.
+type CertAuth struct {
+	// Certificate identity to look at, "cn" (default) or "fingerprint",
+	// the latter being hex encoded SHA-256 of the certificate
+	Match string `yaml:"match"`
+	// Identity to account name mapping. Without an entry the common name
+	// itself is the account name, fingerprints must always be mapped.
+	Accounts map[string]string `yaml:"accounts"`
+	// Log clients in at registration even if they do not use SASL
+	AutoLogin bool `yaml:"autoLogin"`
+	// Nickname must be equal to the common name of the certificate
+	ForceNick bool `yaml:"forceNick"`
+}
+
+// Identity of the certificate according to Match.
+func (c *CertAuth) Identity(cert *x509.Certificate) string {
+	if c.Match == CertMatchFingerprint {
+		return Fingerprint(cert)
+	}
+
+	return cert.Subject.CommonName
+}
+
+// Hex encoded SHA-256 of the certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Account the certificate maps to, if any.
+func (c *CertAuth) Account(cert *x509.Certificate) (string, bool) {
+	identity := c.Identity(cert)
+
+	for id, name := range c.Accounts {
+		// Fingerprints are often written with colons and upper case
+		if strings.EqualFold(strings.ReplaceAll(id, ":", ""), identity) {
+			return name, true
+		}
+	}
+
+	if c.Match == CertMatchFingerprint || identity == "" {
+		return "", false
+	}
+
+	return identity, true
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"net"
+	"time"
+)
+
+// Connection class, limits applied to clients connecting from its hosts.
+type Class struct {
+	Name string `yaml:"name"`
+	// IP addresses or CIDR ranges, empty list matches everybody
+	Hosts []string `yaml:"hosts"`
+	// No flood control at all, e.g. for trusted bots
+	Exempt bool  `yaml:"exempt"`
+	Flood  Flood `yaml:"flood"`
+}
+
+// Flood control token bucket. Zero values mean the server defaults.
+type Flood struct {
+	// Commands which may be sent at once before they get delayed
+	Burst float64 `yaml:"burst"`
+	// Commands per second allowed in the long run
+	Rate float64 `yaml:"rate"`
+	// Delay of commands beyond which the client is disconnected
+	MaxLag time.Duration `yaml:"maxLag"`
+}
+
+// Find the first class matching ip, empty class if none does.
+func (b *Bootstrap) Class(ip net.IP) Class {
+	for _, class := range b.Classes {
+		if class.Matches(ip) {
+			return class
+		}
+	}
+
+	return Class{}
+}
+
+// Check whether ip belongs to the class.
+func (c *Class) Matches(ip net.IP) bool {
+	return len(c.Hosts) == 0 || hostsContain(c.Hosts, ip)
+}
+
+// Check whether ip is one of hosts, given as IP addresses or CIDR ranges.
+func hostsContain(hosts []string, ip net.IP) bool {
+	for _, host := range hosts {
+		if _, network, err := net.ParseCIDR(host); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+
+			continue
+		}
+
+		if net.ParseIP(host).Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
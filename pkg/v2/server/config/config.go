@@ -7,6 +7,8 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
+
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -21,7 +23,16 @@ type Bootstrap struct {
 	SSLKey        string `yaml:"sslKey"`
 	SSLCert       string `yaml:"sslCert"`
 	SSLCA         string `yaml:"sslCA"`
+	Accounts      string `yaml:"accounts"`
+	Bans          string `yaml:"bans"`
 	PrettyConsole bool   `yaml:"prettyConsole"`
+	// Sections below can only be set in the configuration file
+	CertAuth    CertAuth    `yaml:"certAuth"`
+	Classes     []Class     `yaml:"classes"`
+	Connections Connections `yaml:"connections"`
+	History     History     `yaml:"history"`
+	Operators   []Operator  `yaml:"operators"`
+	SendQ       SendQ       `yaml:"sendQ"`
 }
 
 type CAConfig struct {
@@ -51,6 +62,26 @@ func Get() *Bootstrap {
 	return &config
 }
 
+// Read sections of the configuration file which have no command line
+// flags, leaving everything else untouched.
+func (b *Bootstrap) LoadSections(data []byte) error {
+	file := Bootstrap{}
+
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return err
+	}
+
+	b.CertAuth = file.CertAuth
+	b.Classes = file.Classes
+	b.Connections = file.Connections
+	b.History = file.History
+	b.Operators = file.Operators
+	b.SendQ = file.SendQ
+
+	return nil
+}
+
 func (c *Certificate) Loadx509KeyPair() (*x509.Certificate, *rsa.PrivateKey) {
 	cf, e := os.ReadFile(c.Certificate)
 	if e != nil {
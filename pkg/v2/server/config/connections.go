@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net"
+	"time"
+)
+
+// Limits of connections accepted by the server. Zero values mean no limit.
+type Connections struct {
+	// Clients connected at once, exempt hosts included
+	MaxClients int `yaml:"maxClients"`
+	// Connections at once from a single address
+	PerIP int `yaml:"perIP"`
+	// Connections at once from a network of the sizes below
+	PerNetwork int `yaml:"perNetwork"`
+	// Network sizes, zero means /32 for IPv4 and /64 for IPv6
+	IPv4Prefix int `yaml:"ipv4Prefix"`
+	IPv6Prefix int `yaml:"ipv6Prefix"`
+	// Connections accepted from a network within ThrottleWindow
+	Throttle       int           `yaml:"throttle"`
+	ThrottleWindow time.Duration `yaml:"throttleWindow"`
+	// IP addresses or CIDR ranges left out of the per source limits,
+	// e.g. an office behind NAT
+	Exempt []string `yaml:"exempt"`
+}
+
+// Check whether ip is left out of the per source limits.
+func (c *Connections) Exempted(ip net.IP) bool {
+	return hostsContain(c.Exempt, ip)
+}
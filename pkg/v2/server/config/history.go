@@ -0,0 +1,15 @@
+package config
+
+import "time"
+
+// Limits of the message history every room keeps for CHATHISTORY.
+type History struct {
+	// Messages kept per room, zero means the server default
+	Size int `yaml:"size"`
+	// Messages older than that are forgotten, zero keeps them until they
+	// are pushed out by newer ones
+	MaxAge time.Duration `yaml:"maxAge"`
+	// Latest messages replayed to clients joining a room, unless they
+	// negotiated draft/chathistory and can fetch history themselves
+	Replay int `yaml:"replay"`
+}
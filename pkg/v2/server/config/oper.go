@@ -0,0 +1,48 @@
+package config
+
+import "strings"
+
+// Privileges an operator block may grant.
+const (
+	PrivilegeKill    = "kill"
+	PrivilegeWallops = "wallops"
+	PrivilegeRehash  = "rehash"
+	PrivilegeDie     = "die"
+	PrivilegeBan     = "ban"   // KLINE, DLINE and their removal
+	PrivilegeFlood   = "flood" // No flood control
+)
+
+// Operator block, OPER with its name and password grants its privileges.
+type Operator struct {
+	Name string `yaml:"name"`
+	// Password hash as printed by the passwd command
+	Password string `yaml:"password"`
+	// Optional nick!user@host mask the client must match
+	Host string `yaml:"host"`
+	// Optional hex encoded SHA-256 of the TLS client certificate the
+	// client must present
+	Fingerprint string   `yaml:"fingerprint"`
+	Privileges  []string `yaml:"privileges"`
+}
+
+// Find operator block by its name.
+func (b *Bootstrap) Operator(name string) (*Operator, bool) {
+	for i := range b.Operators {
+		if b.Operators[i].Name == name {
+			return &b.Operators[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Check whether the fingerprint is the one of the block. Blocks without
+// fingerprint accept any.
+func (o *Operator) FingerprintMatches(fingerprint string) bool {
+	if o.Fingerprint == "" {
+		return true
+	}
+
+	// Fingerprints are often written with colons and upper case
+	return strings.EqualFold(strings.ReplaceAll(o.Fingerprint, ":", ""), fingerprint)
+}
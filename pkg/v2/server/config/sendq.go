@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// Limits of data waiting to be sent to a single client.
+type SendQ struct {
+	// Bytes queued for a client before it is disconnected as too slow,
+	// zero means the server default
+	Size int `yaml:"size"`
+	// Time a single write may take, zero means the server default
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+}
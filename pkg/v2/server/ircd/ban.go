@@ -0,0 +1,220 @@
+package ircd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/ban"
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/config"
+)
+
+// KLINE and DLINE: [minutes] mask [:reason]. Connected clients matching the
+// new line are disconnected right away. There are no G-lines, they are
+// K-lines spread over linked servers and this server is never linked.
+func (s *Server) HandlerLine(cli *client.Client, command string, params []string) {
+	if !s.Privileged(cli, config.PrivilegeBan) {
+		return
+	}
+
+	if len(params) == 0 {
+		err := cli.ReplyNotEnoughParameters(command)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	now := time.Now()
+	line := ban.Line{SetBy: cli.String(), SetAt: now, Reason: "No reason"}
+
+	if minutes, err := strconv.Atoi(params[0]); err == nil && minutes > 0 {
+		line.Expires = now.Add(time.Duration(minutes) * time.Minute)
+		params = params[1:]
+	}
+
+	if len(params) == 0 {
+		err := cli.ReplyNotEnoughParameters(command)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	first := params[0]
+	if reason := strings.Join(params[1:], " "); reason != "" {
+		line.Reason = reason
+	}
+
+	var err error
+
+	if command == "KLINE" {
+		line.Mask, err = ban.NormalizeKLine(first)
+	} else {
+		line.Mask, err = ban.NormalizeDLine(first)
+	}
+
+	if err != nil {
+		s.Notice(cli, fmt.Sprintf("Invalid %s mask %s", command, first))
+
+		return
+	}
+
+	if command == "KLINE" {
+		err = s.bans.AddKLine(line)
+	} else {
+		err = s.bans.AddDLine(line)
+	}
+
+	s.log.Info().Str("operator", cli.Nickname()).Str("mask", line.Mask).Str("reason", line.Reason).Msg(command)
+
+	duration := "permanent"
+	if !line.Expires.IsZero() {
+		duration = line.Expires.Sub(now).String()
+	}
+
+	s.Notice(cli, fmt.Sprintf("Added %s for %s (%s): %s", command, line.Mask, duration, line.Reason))
+
+	if err != nil {
+		s.BanNotSaved(cli, err)
+	}
+
+	for c := range s.clients {
+		ip := net.ParseIP(c.Host())
+
+		var banned bool
+		if command == "KLINE" {
+			_, banned = s.bans.MatchKLine(c.Nickname(), c.Username, ip)
+		} else {
+			_, banned = s.bans.MatchDLine(ip)
+		}
+
+		if banned {
+			s.Disconnect(c, command[:1]+"-lined: "+line.Reason)
+		}
+	}
+}
+
+// UNKLINE and UNDLINE: mask.
+func (s *Server) HandlerUnLine(cli *client.Client, command string, params []string) {
+	if !s.Privileged(cli, config.PrivilegeBan) {
+		return
+	}
+
+	if len(params) == 0 {
+		err := cli.ReplyNotEnoughParameters(command)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	m := params[0]
+	kind := strings.TrimPrefix(command, "UN")
+
+	var (
+		found bool
+		err   error
+	)
+
+	if command == "UNKLINE" {
+		m, err = ban.NormalizeKLine(m)
+	} else {
+		m, err = ban.NormalizeDLine(m)
+	}
+
+	if err != nil {
+		s.Notice(cli, fmt.Sprintf("Invalid %s mask %s", kind, params[0]))
+
+		return
+	}
+
+	if command == "UNKLINE" {
+		found, err = s.bans.RemoveKLine(m)
+	} else {
+		found, err = s.bans.RemoveDLine(m)
+	}
+
+	if !found {
+		s.Notice(cli, fmt.Sprintf("No %s for %s", kind, m))
+
+		return
+	}
+
+	s.log.Info().Str("operator", cli.Nickname()).Str("mask", m).Msg(command)
+	s.Notice(cli, fmt.Sprintf("Removed %s for %s", kind, m))
+
+	if err != nil {
+		s.BanNotSaved(cli, err)
+	}
+}
+
+// Tell the operator that a ban change applies but could not be written to
+// the ban file, so it is lost on restart.
+func (s *Server) BanNotSaved(cli *client.Client, err error) {
+	s.log.Err(err).Msg("cannot save bans")
+	s.Notice(cli, "Ban list could not be saved, the change is not persisted and is lost on restart")
+}
+
+// Check K-lines for the client about to complete registration,
+// disconnecting it with 465 if banned.
+func (s *Server) KLined(cli *client.Client) bool {
+	line, banned := s.bans.MatchKLine(cli.Nickname(), cli.Username, net.ParseIP(cli.Host()))
+	if !banned {
+		return false
+	}
+
+	err := cli.ReplyNicknamed("465", "You are banned from this server- "+line.Reason)
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.Disconnect(cli, "K-lined: "+line.Reason)
+
+	return true
+}
+
+// Check D-lines for a connection just accepted, closing it if banned.
+func (s *Server) DLined(conn net.Conn) bool {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return false
+	}
+
+	line, banned := s.bans.MatchDLine(net.ParseIP(host))
+	if !banned {
+		return false
+	}
+
+	s.log.Info().Str("remote", host).Str("mask", line.Mask).Msg("D-lined connection")
+	s.RefuseConnection(conn, host, "D-lined: "+line.Reason)
+
+	return true
+}
+
+// Tell a connection just accepted why it is refused and close it. That is
+// done aside with a deadline: writing runs the TLS handshake first, a peer
+// never finishing it must not hold up accepting others.
+func (s *Server) RefuseConnection(conn net.Conn, host, reason string) {
+	go func() {
+		err := conn.SetDeadline(time.Now().Add(client.WriteCloseTimeout))
+		if err == nil {
+			_, err = conn.Write([]byte(fmt.Sprintf("ERROR :Closing Link: %s (%s)%s", host, reason, client.CRLF)))
+		}
+
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		err = conn.Close()
+		if err != nil {
+			s.log.Err(err).Msg("closing connection")
+		}
+	}()
+}
@@ -0,0 +1,42 @@
+package ircd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/ban"
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanNotSaved(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	// Directory of the file is missing, every save fails
+	bans, err := ban.Open(filepath.Join(t.TempDir(), "missing", "bans.yaml"))
+	require.NoError(t, err)
+
+	s := startTestServer(t, Bans(bans), Config(&config.Bootstrap{
+		Bind: "127.0.0.1:0",
+		Operators: []config.Operator{{
+			Name:       "admin",
+			Password:   string(hash),
+			Privileges: []string{config.PrivilegeBan},
+		}},
+	}))
+
+	alice := dialTest(t, s, "alice")
+	alice.send("OPER admin secret")
+	alice.expect(" 381 ")
+
+	alice.send("KLINE *!*@banned.test :spam")
+	alice.expect("Added KLINE for *!*@banned.test")
+	alice.expect("not persisted")
+
+	alice.send("UNKLINE *!*@banned.test")
+	alice.expect("Removed KLINE for *!*@banned.test")
+	alice.expect("not persisted")
+}
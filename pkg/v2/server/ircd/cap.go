@@ -0,0 +1,168 @@
+package ircd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+)
+
+const (
+	CapLineLength = 510 // Max length of a CAP LS/LIST line without CRLF
+)
+
+// Handle CAP negotiation. Registration of a client is held back from its
+// first CAP LS or REQ until CAP END.
+func (s *Server) HandlerCap(cli *client.Client, params []string) {
+	if len(params) == 0 {
+		err := cli.ReplyNotEnoughParameters("CAP")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	subcommand := strings.ToUpper(params[0])
+
+	switch subcommand {
+	case "LS":
+		if !cli.Registered {
+			cli.Negotiating = true
+		}
+
+		if len(params) > 1 {
+			version, err := strconv.Atoi(params[1])
+			if err == nil && version > cli.CapVersion {
+				cli.CapVersion = version
+			}
+		}
+
+		// cap-notify is implicitly enabled for CAP 302 clients
+		if cli.CapVersion >= caps.Version302 {
+			cli.Caps.Enable(caps.CapNotify)
+		}
+
+		tokens := []string{}
+		for _, c := range caps.List() {
+			tokens = append(tokens, c.Token(cli.CapVersion))
+		}
+
+		s.SendCapList(cli, "LS", tokens)
+
+	case "LIST":
+		s.SendCapList(cli, "LIST", cli.Caps.Names())
+
+	case "REQ":
+		requested := strings.Join(params[1:], " ")
+
+		// Nothing to acknowledge in an empty request
+		if len(strings.Fields(requested)) == 0 {
+			err := cli.ReplyNotEnoughParameters("CAP")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			return
+		}
+
+		if !cli.Registered {
+			cli.Negotiating = true
+		}
+
+		// Request is applied as a whole or not at all
+		for _, name := range strings.Fields(requested) {
+			disable := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+
+			_, found := caps.Get(name)
+			if !found || (disable && name == caps.CapNotify && cli.CapVersion >= caps.Version302) {
+				err := cli.ReplyParts("CAP", cli.Nickname(), "NAK", requested)
+				if err != nil {
+					s.log.Err(err).Msg("cannot send message")
+				}
+
+				return
+			}
+		}
+
+		for _, name := range strings.Fields(requested) {
+			if strings.HasPrefix(name, "-") {
+				cli.Caps.Disable(strings.TrimPrefix(name, "-"))
+			} else {
+				cli.Caps.Enable(name)
+			}
+		}
+
+		err := cli.ReplyParts("CAP", cli.Nickname(), "ACK", requested)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+	case "END":
+		if cli.Registered {
+			return
+		}
+
+		cli.Negotiating = false
+		s.CompleteRegistration(cli)
+
+	default:
+		err := cli.ReplyNicknamed("410", subcommand, "Invalid CAP command")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
+
+// Send CAP LS or LIST reply. CAP 302 clients get it split over several
+// lines marked with "*", older ones always get a single line.
+func (s *Server) SendCapList(cli *client.Client, subcommand string, tokens []string) {
+	base := len(":"+s.Config().Hostname+" CAP "+cli.Nickname()+" "+subcommand+" ") + len("* :")
+	length := base
+	line := []string{}
+
+	for _, token := range tokens {
+		if cli.CapVersion >= caps.Version302 && len(line) > 0 && length+len(token) > CapLineLength {
+			err := cli.ReplyParts("CAP", cli.Nickname(), subcommand, "*", strings.Join(line, " "))
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			length = base
+			line = []string{}
+		}
+
+		line = append(line, token)
+		length += len(token) + 1
+	}
+
+	err := cli.ReplyParts("CAP", cli.Nickname(), subcommand, strings.Join(line, " "))
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Tell clients which negotiated cap-notify about a capability declared or
+// withdrawn while they are connected.
+func (s *Server) NotifyCapChange(change caps.Change) {
+	for c := range s.clients {
+		if !c.Caps.Has(caps.CapNotify) {
+			continue
+		}
+
+		var err error
+
+		if change.Added {
+			err = c.ReplyParts("CAP", c.Nickname(), "NEW", change.Capability.Token(c.CapVersion))
+		} else {
+			c.Caps.Disable(change.Capability.Name)
+			err = c.ReplyParts("CAP", c.Nickname(), "DEL", change.Capability.Name)
+		}
+
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
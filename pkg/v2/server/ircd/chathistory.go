@@ -0,0 +1,179 @@
+package ircd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+	"github.com/simplefxn/goircd/pkg/v2/server/room"
+)
+
+// CHATHISTORY subcommand of draft/chathistory. Only history of rooms cli
+// is a member of can be retrieved, private messages are not kept.
+func (s *Server) HandlerChatHistory(cli *client.Client, args []string) {
+	if len(args) == 0 {
+		s.ChatHistoryFail(cli, "NEED_MORE_PARAMS", "Missing parameters")
+
+		return
+	}
+
+	subcommand := strings.ToUpper(args[0])
+
+	need := 4
+	switch subcommand {
+	case "BETWEEN":
+		need = 5
+	case "AFTER", "AROUND", "BEFORE", "LATEST", "TARGETS":
+	default:
+		s.ChatHistoryFail(cli, "UNKNOWN_COMMAND", "Unknown command", subcommand)
+
+		return
+	}
+
+	if len(args) < need {
+		s.ChatHistoryFail(cli, "NEED_MORE_PARAMS", "Missing parameters", subcommand)
+
+		return
+	}
+
+	limit, err := strconv.Atoi(args[need-1])
+	if err != nil || limit < 1 {
+		s.ChatHistoryFail(cli, "INVALID_PARAMS", "Invalid limit", subcommand)
+
+		return
+	}
+
+	if limit > room.HistoryMaxLimit {
+		limit = room.HistoryMaxLimit
+	}
+
+	if subcommand == "TARGETS" {
+		s.SendChatHistoryTargets(cli, args[1], args[2], limit)
+
+		return
+	}
+
+	target := args[1]
+
+	r, found := s.Room(target)
+	if found {
+		_, found = r.Membership(cli)
+	}
+
+	if !found {
+		s.ChatHistoryFail(cli, "INVALID_TARGET", "Messages could not be retrieved", subcommand, target)
+
+		return
+	}
+
+	selectors := make([]room.Selector, need-3)
+	for i := range selectors {
+		selectors[i], err = room.ParseSelector(args[2+i])
+		if err == nil && selectors[i].Empty() && subcommand != "LATEST" {
+			err = room.ErrBadSelector
+		}
+
+		if err != nil {
+			s.ChatHistoryFail(cli, "INVALID_PARAMS", "Invalid message selector", subcommand, args[2+i])
+
+			return
+		}
+	}
+
+	var entries []room.HistoryEntry
+
+	switch subcommand {
+	case "AFTER":
+		entries = r.History.After(selectors[0], limit)
+	case "AROUND":
+		entries = r.History.Around(selectors[0], limit)
+	case "BEFORE":
+		entries = r.History.Before(selectors[0], limit)
+	case "BETWEEN":
+		entries = r.History.Between(selectors[0], selectors[1], limit)
+	case "LATEST":
+		entries = r.History.Latest(selectors[0], limit)
+	}
+
+	r.SendHistory(cli, entries)
+}
+
+// Send rooms of cli with messages between the two timestamps, each along
+// with the time of its latest message.
+func (s *Server) SendChatHistoryTargets(cli *client.Client, from, to string, limit int) {
+	first, errFirst := room.ParseSelector(from)
+	second, errSecond := room.ParseSelector(to)
+
+	if errFirst != nil || errSecond != nil || first.Time.IsZero() || second.Time.IsZero() {
+		s.ChatHistoryFail(cli, "INVALID_PARAMS", "Invalid timestamp", "TARGETS")
+
+		return
+	}
+
+	reversed := first.Time.After(second.Time)
+	if reversed {
+		first, second = second, first
+	}
+
+	type target struct {
+		name   string
+		latest time.Time
+	}
+
+	targets := []target{}
+
+	for _, r := range s.rooms {
+		if _, subscribed := r.Membership(cli); !subscribed {
+			continue
+		}
+
+		latest, found := r.History.LatestTime()
+		if !found || !latest.After(first.Time) || !latest.Before(second.Time) {
+			continue
+		}
+
+		targets = append(targets, target{name: r.Name, latest: latest})
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].latest.Before(targets[j].latest)
+	})
+
+	if len(targets) > limit {
+		if reversed {
+			targets = targets[len(targets)-limit:]
+		} else {
+			targets = targets[:limit]
+		}
+	}
+
+	ref, err := cli.StartBatch("draft/chathistory-targets")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	for _, t := range targets {
+		msg := message.New(s.Config().Hostname, "CHATHISTORY", "TARGETS", t.name, t.latest.UTC().Format(message.TimeFormat))
+
+		err = cli.RespondTagged(message.Tags{}.WithBatch(ref), msg.String())
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+
+	err = cli.EndBatch(ref)
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Send standard reply FAIL for CHATHISTORY.
+func (s *Server) ChatHistoryFail(cli *client.Client, code, description string, context ...string) {
+	err := cli.ReplyParts("FAIL", append(append([]string{"CHATHISTORY", code}, context...), description)...)
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
@@ -0,0 +1,146 @@
+package ircd
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Started client whose output is read from the returned connection.
+func newTestClient(t *testing.T) (*client.Client, *bufio.Reader) {
+	t.Helper()
+
+	logger := zerolog.Nop()
+	local, remote := net.Pipe()
+
+	cli, err := client.New(
+		client.Config(&config.Bootstrap{}),
+		client.Logger(&logger),
+		client.Hostname("irc.test"),
+		client.Connection(local),
+		client.Events(make(chan client.Event, 1)),
+	)
+	require.NoError(t, err)
+
+	cli.Start(context.Background())
+
+	t.Cleanup(func() {
+		remote.Close()
+		local.Close()
+	})
+
+	return cli, bufio.NewReader(remote)
+}
+
+// Server listening on a random local port, stopped when the test ends.
+// The configuration may be tweaked before it starts.
+func newTestServer(t *testing.T, configure ...func(cfg *config.Bootstrap)) *Server {
+	t.Helper()
+
+	cfg := &config.Bootstrap{Bind: "127.0.0.1:0"}
+
+	for _, c := range configure {
+		c(cfg)
+	}
+
+	return startTestServer(t, Config(cfg))
+}
+
+// Server started with the options, stopped when the test ends. Its
+// configuration must bind a random local port.
+func startTestServer(t *testing.T, opts ...ServerOption) *Server {
+	t.Helper()
+
+	logger := zerolog.Nop()
+
+	s, err := New(append([]ServerOption{Logger(&logger)}, opts...)...)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = s.Start(context.Background())
+
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		s.stop <- true
+		<-done
+	})
+
+	return s
+}
+
+// Connection of a test client to a test server.
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Connect to the server and register with nickname, unless it is empty.
+func dialTest(t *testing.T, s *Server, nickname string) *testConn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	c := &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	if nickname != "" {
+		c.send("NICK " + nickname)
+		c.send("USER " + nickname + " 0 * :" + nickname)
+		c.expect(" 001 ")
+	}
+
+	return c
+}
+
+func (c *testConn) send(line string) {
+	c.t.Helper()
+
+	_, err := c.conn.Write([]byte(line + "\r\n"))
+	require.NoError(c.t, err)
+}
+
+// Read lines until one containing text, which is returned without CRLF.
+func (c *testConn) expect(text string) string {
+	c.t.Helper()
+
+	lines := c.readUntil(text)
+
+	return lines[len(lines)-1]
+}
+
+// Read lines, CRLF stripped, up to and including one containing text.
+func (c *testConn) readUntil(text string) []string {
+	c.t.Helper()
+
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+
+	lines := []string{}
+
+	for {
+		line, err := c.r.ReadString('\n')
+		require.NoError(c.t, err, "waiting for %q", text)
+
+		line = strings.TrimRight(line, "\r\n")
+		lines = append(lines, line)
+
+		if strings.Contains(line, text) {
+			return lines
+		}
+	}
+}
@@ -9,52 +9,90 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/simplefxn/goircd/internal/pipeline"
+	"github.com/simplefxn/goircd/pkg/v2/server/account"
+	"github.com/simplefxn/goircd/pkg/v2/server/ban"
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
 	"github.com/simplefxn/goircd/pkg/v2/server/client"
 	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
 	"github.com/simplefxn/goircd/pkg/v2/server/room"
 
 	"github.com/rs/zerolog"
 )
 
 var (
-	ReNickname = regexp.MustCompile("^[a-zA-Z0-9-]{1,16}$")
+	ReNickname = regexp.MustCompile(fmt.Sprintf("^[a-zA-Z0-9\\[\\]\\\\`_^{|}-]{1,%d}$", NicknameMaxLength))
 )
 
 const (
+	NicknameMaxLength  = 16
+	UserhostMaxTargets = 5 // Max nicknames a single USERHOST is answered for
+
 	PingTimeout    = time.Second * 180 // Max time deadline for client's unresponsiveness
 	PingThreshold  = time.Second * 90  // Max idle client's time before PING are sent
 	AlivenessCheck = time.Second * 10  // Client's aliveness check period
+
+	ShutdownTimeout = time.Second * 5 // Time left to clients for writing what was queued
 )
 
 type Server struct {
 	lastAlivenessCheck time.Time
 	listener           net.Listener
 	pipe               pipeline.Pipeline
-	config             *config.Bootstrap
+	config             atomic.Pointer[config.Bootstrap] // Swapped as a whole on REHASH
+	configFile         string                           // Re-read on REHASH
+	accounts           account.Store
+	bans               *ban.List
+	limits             *connLimits
 	log                *zerolog.Logger
 	stop               chan bool
 	events             chan client.Event
+	capChanges         chan caps.Change
+	results            chan func() // Results of work offloaded from the main loop
 	clients            map[*client.Client]bool
-	rooms              map[string]*room.Room
+	sasl               map[*client.Client]*saslSession
+	saslFailures       map[*client.Client]int
+	operFailures       map[*client.Client]int
+	operChecks         map[*client.Client]bool              // Clients whose OPER password is being checked
+	labeled            *client.Client                       // Client whose labelled command is handled
+	labelRooms         map[*room.Room]bool                  // Rooms the labelled command was sent to
+	monitors           map[string]map[*client.Client]bool   // Watchers of lowercased nicknames
+	monitoring         map[*client.Client]map[string]string // Nicknames monitored by each client
+	rooms              map[string]*room.Room                // Keyed by casefolded name, see room.Fold
 	roomCh             map[*room.Room]chan client.Event
 	name               string
 	isStarted          bool
+	isTLS              bool
 }
 
 type ServerOption func(o *Server)
 
 func Config(cfg *config.Bootstrap) ServerOption {
-	return func(s *Server) { s.config = cfg }
+	return func(s *Server) { s.config.Store(cfg) }
+}
+
+func ConfigFile(path string) ServerOption {
+	return func(s *Server) { s.configFile = path }
 }
 
 func Logger(logger *zerolog.Logger) ServerOption {
 	return func(s *Server) { s.log = logger }
 }
 
+func Accounts(store account.Store) ServerOption {
+	return func(s *Server) { s.accounts = store }
+}
+
+func Bans(list *ban.List) ServerOption {
+	return func(s *Server) { s.bans = list }
+}
+
 func Next(next pipeline.Pipeline) ServerOption {
 	return func(s *Server) { s.pipe = next }
 }
@@ -75,21 +113,37 @@ func New(opts ...ServerOption) (*Server, error) {
 	var err error
 
 	srv := &Server{
-		stop:    make(chan bool),
-		events:  make(chan client.Event),
-		clients: make(map[*client.Client]bool),
-		rooms:   make(map[string]*room.Room),
-		roomCh:  make(map[*room.Room]chan client.Event),
+		stop:         make(chan bool),
+		events:       make(chan client.Event),
+		capChanges:   make(chan caps.Change),
+		results:      make(chan func()),
+		clients:      make(map[*client.Client]bool),
+		sasl:         make(map[*client.Client]*saslSession),
+		saslFailures: make(map[*client.Client]int),
+		operFailures: make(map[*client.Client]int),
+		operChecks:   make(map[*client.Client]bool),
+		labelRooms:   make(map[*room.Room]bool),
+		monitors:     make(map[string]map[*client.Client]bool),
+		monitoring:   make(map[*client.Client]map[string]string),
+		rooms:        make(map[string]*room.Room),
+		roomCh:       make(map[*room.Room]chan client.Event),
 	}
 
 	for _, o := range opts {
 		o(srv)
 	}
 
-	if srv.config == nil {
+	if srv.Config() == nil {
 		return nil, fmt.Errorf("cannot start ircd without a configuration")
 	}
 
+	// Bans can still be set, they are just not saved
+	if srv.bans == nil {
+		srv.bans, _ = ban.Open("")
+	}
+
+	srv.limits = newConnLimits(srv.Config().Connections)
+
 	if srv.name == "" {
 		logger = srv.log.With().Str("task", "task").Logger()
 	} else {
@@ -100,25 +154,38 @@ func New(opts ...ServerOption) (*Server, error) {
 
 	tlsConfig := config.Get().GetServerConfig()
 	if tlsConfig != nil {
-		listener, err = tls.Listen("tcp", srv.config.Bind, tlsConfig)
+		listener, err = tls.Listen("tcp", srv.Config().Bind, tlsConfig)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		listener, err = net.Listen("tcp", srv.config.Bind)
+		listener, err = net.Listen("tcp", srv.Config().Bind)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	srv.listener = listener
+	srv.isTLS = tlsConfig != nil
+
+	caps.Watch(srv.capChanges)
+
+	if mechanisms := srv.SASLMechanisms(); len(mechanisms) > 0 {
+		caps.Register(CapSASL, strings.Join(mechanisms, ","))
+	}
 
 	hostname, _ := os.Hostname()
-	srv.config.Hostname = hostname
+	srv.Config().Hostname = hostname
 
 	return srv, nil
 }
 
+// Current configuration. It is never changed in place, so it may be read
+// from any goroutine.
+func (s *Server) Config() *config.Bootstrap {
+	return s.config.Load()
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	s.isStarted = true
 
@@ -129,15 +196,22 @@ func (s *Server) Start(ctx context.Context) error {
 	}()
 
 	for {
+		// Complete the response to the labelled command handled last
+		s.EndLabel()
+
 		select {
 		case <-s.stop:
 			err := s.Stop(ctx)
 			return err
+		case change := <-s.capChanges:
+			s.NotifyCapChange(change)
+		case apply := <-s.results:
+			apply()
 		case ev := <-s.events:
 			s.log.Debug().Dict("details",
 				zerolog.Dict().
 					Str("type", ev.EventType.String()).
-					Str("text", ev.Text).
+					Str("text", ev.Message.String()).
 					Str("remote", ev.Client.RemoteHost),
 			).Msg("received event")
 
@@ -152,7 +226,7 @@ func (s *Server) Start(ctx context.Context) error {
 				s.clients[cli] = true
 
 			case client.EventDel:
-				delete(s.clients, cli)
+				s.ClientGone(cli, cli.CloseReason())
 				// Forward event to room
 				/*
 						for _, room_sink := range daemon.room_sinks {
@@ -161,11 +235,21 @@ func (s *Server) Start(ctx context.Context) error {
 				*/
 			case client.EventMode:
 			case client.EventMsg:
-				cols := strings.SplitN(ev.Text, " ", 2)
-				command := strings.ToUpper(cols[0])
+				msg := ev.Message
+				if cli.StartLabel(msg.Tags[message.TagLabel]) {
+					s.labeled = cli
+				}
+
+				command := strings.ToUpper(msg.Command)
+				params := msg.Params
 
 				if command == "QUIT" {
-					delete(s.clients, cli)
+					reason := "Client Quit"
+					if len(params) > 0 {
+						reason = "Quit: " + params[0]
+					}
+
+					s.ClientGone(cli, reason)
 
 					err := cli.Stop(ctx)
 					if err != nil {
@@ -175,21 +259,97 @@ func (s *Server) Start(ctx context.Context) error {
 					continue
 				}
 
+				if command == "CAP" {
+					s.HandlerCap(cli, params)
+
+					continue
+				}
+
+				if command == "AUTHENTICATE" {
+					s.HandlerAuthenticate(cli, params)
+
+					continue
+				}
+
 				if !cli.Registered {
-					s.ClientRegister(cli, command, cols)
+					s.ClientRegister(cli, command, params)
 
 					continue
 				}
 
 				switch command {
 				case "AWAY":
-					continue
+					s.HandlerAway(cli, msg.Param(0))
+				case "CHATHISTORY":
+					s.HandlerChatHistory(cli, params)
+
+				case "DIE":
+					s.HandlerDie(cli)
+
+				case "DLINE", "KLINE":
+					s.HandlerLine(cli, command, params)
+
+				case "INVITE":
+					if len(params) < 2 {
+						s.log.Debug().Dict("details",
+							zerolog.Dict().
+								Str("type", ev.EventType.String()).
+								Str("text", ev.Message.String()).
+								Str("remote", ev.Client.RemoteHost),
+						).Msg("INVITE not enough parameters")
+						err := cli.ReplyNotEnoughParameters("INVITE")
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					target := s.Client(params[0])
+					if target == nil {
+						err := cli.ReplyNoNickChan(params[0])
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					r, found := s.Room(params[1])
+					if !found {
+						err := cli.ReplyNoChannel(params[1])
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					s.SendRoom(r, client.Event{
+						Client:    cli,
+						Target:    target,
+						EventType: client.EventInvite,
+					})
+
+				case "ISON":
+					if len(params) == 0 {
+						err := cli.ReplyNotEnoughParameters("ISON")
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					// Nicknames may come as separate parameters or a single trailing one
+					s.SendIson(cli, strings.Fields(strings.Join(params, " ")))
+
 				case "JOIN":
-					if len(cols) == 1 || len(cols[1]) < 1 {
+					if len(params) == 0 || params[0] == "" {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("JOIN not enough parameters")
 						err := cli.ReplyNotEnoughParameters("JOIN")
@@ -200,20 +360,57 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					go s.HandlerJoin(cli, cols[1])
+					// Rooms are registered by the server loop only, concurrent
+					// joins would otherwise create the same room twice
+					s.HandlerJoin(cli, params[0], msg.Param(1))
+
+				case "KICK":
+					if len(params) < 2 {
+						s.log.Debug().Dict("details",
+							zerolog.Dict().
+								Str("type", ev.EventType.String()).
+								Str("text", ev.Message.String()).
+								Str("remote", ev.Client.RemoteHost),
+						).Msg("KICK not enough parameters")
+						err := cli.ReplyNotEnoughParameters("KICK")
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					r, found := s.Room(params[0])
+					if !found {
+						err := cli.ReplyNoChannel(params[0])
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					s.SendRoom(r, client.Event{
+						Client:    cli,
+						EventType: client.EventKick,
+						Message:   msg,
+					})
+
+				case "KILL":
+					s.HandlerKill(cli, params)
 
 				case "LIST":
-					s.SendList(cli, cols)
+					s.SendList(cli, params)
 
 				case "LUSERS":
-					go s.SendLusers(cli)
+					s.SendLusers(cli)
 
 				case "MODE":
-					if len(cols) == 1 || len(cols[1]) < 1 {
+					if len(params) == 0 {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("MODE not enough parameters")
 						err := cli.ReplyNotEnoughParameters("MODE")
@@ -224,31 +421,29 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					cols = strings.SplitN(cols[1], " ", 2)
-					if cols[0] == cli.Username {
-						if len(cols) == 1 {
-							err := cli.Msg("221 " + cli.Nickname + " +")
-							if err != nil {
-								return err
-							}
-						} else {
-							err := cli.ReplyNicknamed("501", "Unknown MODE flag")
-							if err != nil {
-								return err
-							}
+					if strings.EqualFold(params[0], cli.Nickname()) {
+						s.HandlerUserMode(cli, msg.Param(1))
+
+						continue
+					}
+
+					if s.Client(params[0]) != nil {
+						err := cli.ReplyNicknamed("502", "Cant change mode for other users")
+						if err != nil {
+							return err
 						}
 
 						continue
 					}
 
-					rm := cols[0]
+					rm := params[0]
 
-					r, found := s.rooms[rm]
+					r, found := s.Room(rm)
 					if !found {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("no channel")
 						err := cli.ReplyNoChannel(rm)
@@ -259,27 +454,58 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					if len(cols) == 1 {
-						s.roomCh[r] <- client.Event{
-							Client:    cli,
-							Text:      "",
-							EventType: client.EventMode}
-					} else {
-						s.roomCh[r] <- client.Event{
+					s.SendRoom(r, client.Event{
+						Client:    cli,
+						Message:   msg,
+						EventType: client.EventMode,
+					})
+
+				case "MONITOR":
+					s.HandlerMonitor(cli, params)
+
+				case "MOTD":
+					s.SendMotd(cli)
+
+				case "NAMES":
+					if len(params) == 0 || params[0] == "" {
+						s.SendNamesAll(cli)
+
+						continue
+					}
+
+					for _, rm := range strings.Split(params[0], ",") {
+						r, found := s.Room(rm)
+						if !found {
+							err := cli.ReplyNicknamed("366", rm, "End of NAMES list")
+							if err != nil {
+								return err
+							}
+
+							continue
+						}
+
+						s.SendRoom(r, client.Event{
 							Client:    cli,
-							Text:      cols[1],
-							EventType: client.EventMode}
+							Message:   message.New("", "NAMES", rm),
+							EventType: client.EventNames,
+						})
+
+						// Keep replies in the order rooms were asked for
+						s.SyncRoom(r, cli)
 					}
 
-				case "MOTD":
-					go s.SendMotd(cli)
+				case "NICK":
+					s.HandlerNick(cli, params)
+
+				case "OPER":
+					s.HandlerOper(cli, params)
 
 				case "PART":
-					if len(cols) == 1 || len(cols[1]) < 1 {
+					if len(params) == 0 || params[0] == "" {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("PART not enough parameters")
 						err := cli.ReplyNotEnoughParameters("PART")
@@ -291,8 +517,8 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					for _, rm := range strings.Split(cols[1], ",") {
-						r, found := s.rooms[rm]
+					for _, rm := range strings.Split(params[0], ",") {
+						r, found := s.Room(rm)
 						if !found {
 							err := cli.ReplyNoChannel(rm)
 							if err != nil {
@@ -302,15 +528,15 @@ func (s *Server) Start(ctx context.Context) error {
 							continue
 						}
 
-						s.roomCh[r] <- client.Event{
+						s.SendRoom(r, client.Event{
 							Client:    cli,
-							Text:      "",
+							Message:   msg,
 							EventType: client.EventDel,
-						}
+						})
 					}
 
 				case "PING":
-					if len(cols) == 1 {
+					if len(params) == 0 {
 						err := cli.ReplyNicknamed("409", "No origin specified")
 						if err != nil {
 							return err
@@ -319,7 +545,7 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					err := cli.Reply(fmt.Sprintf("PONG %s :%s", s.config.Hostname, cols[1]))
+					err := cli.ReplyParts("PONG", s.Config().Hostname, params[0])
 					if err != nil {
 						return err
 					}
@@ -328,11 +554,11 @@ func (s *Server) Start(ctx context.Context) error {
 					continue
 
 				case "NOTICE", "PRIVMSG":
-					if len(cols) == 1 {
+					if len(params) == 0 {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("NOTICE/PRIVMSG not receipient given")
 						err := cli.ReplyNicknamed("411", "No recipient given ("+command+")")
@@ -343,12 +569,11 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					cols = strings.SplitN(cols[1], " ", 2)
-					if len(cols) == 1 {
+					if len(params) < 2 || params[1] == "" {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("NOTICE/PRIVMSG no text to send")
 
@@ -360,45 +585,117 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					msg := ""
+					target, text := params[0], params[1]
+
+					if c := s.Client(target); c != nil {
+						line := message.New(cli.String(), command, c.Nickname(), text).String()
+						tags := msg.Tags.ClientOnly().WithTime(time.Now()).WithMsgID()
 
-					target := strings.ToLower(cols[0])
-					for c := range s.clients {
-						if c.Nickname == target {
-							msg = fmt.Sprintf(":%s %s %s :%s", cli, command, c.Nickname, cols[1])
+						err := c.MsgTagged(tags, line)
+						if err != nil {
+							return err
+						}
 
-							err := c.Msg(msg)
+						if c != cli {
+							err = cli.Echo(tags, line)
 							if err != nil {
 								return err
 							}
+						}
 
-							break
+						if command == "PRIVMSG" && c.IsAway() {
+							err = cli.ReplyNicknamed("301", c.Nickname(), c.AwayMessage())
+							if err != nil {
+								return err
+							}
 						}
-					}
 
-					if msg != "" {
 						continue
 					}
 
-					r, found := s.rooms[target]
+					r, found := s.Room(target)
 					if !found {
 						err := cli.ReplyNoNickChan(target)
 						if err != nil {
 							return err
 						}
+
+						continue
 					}
 
-					s.roomCh[r] <- client.Event{
+					s.SendRoom(r, client.Event{
 						Client:    cli,
 						EventType: client.EventMsg,
-						Text:      command + " " + strings.TrimLeft(cols[1], ":"),
+						Message: message.Message{
+							Tags:    msg.Tags.ClientOnly(),
+							Command: command,
+							Params:  []string{target, text},
+						},
+					})
+
+				case "REHASH":
+					s.HandlerRehash(cli)
+
+				case "TAGMSG":
+					if len(params) == 0 {
+						err := cli.ReplyNicknamed("411", "No recipient given ("+command+")")
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					target := params[0]
+
+					if c := s.Client(target); c != nil {
+						line := message.New(cli.String(), "TAGMSG", c.Nickname()).String()
+						tags := msg.Tags.ClientOnly().WithTime(time.Now()).WithMsgID()
+
+						// Message consisting of tags only makes no sense without them
+						if c.Caps.Has(client.CapMessageTags) {
+							err := c.MsgTagged(tags, line)
+							if err != nil {
+								return err
+							}
+						}
+
+						if c != cli && cli.Caps.Has(client.CapMessageTags) {
+							err := cli.Echo(tags, line)
+							if err != nil {
+								return err
+							}
+						}
+
+						continue
 					}
+
+					r, found := s.Room(target)
+					if !found {
+						err := cli.ReplyNoNickChan(target)
+						if err != nil {
+							return err
+						}
+
+						continue
+					}
+
+					s.SendRoom(r, client.Event{
+						Client:    cli,
+						EventType: client.EventMsg,
+						Message: message.Message{
+							Tags:    msg.Tags.ClientOnly(),
+							Command: command,
+							Params:  []string{target},
+						},
+					})
+
 				case "TOPIC":
-					if len(cols) == 1 {
+					if len(params) == 0 {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("TOPIC not enough parameters")
 						err := cli.ReplyNotEnoughParameters("TOPIC")
@@ -409,11 +706,9 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					cols = strings.SplitN(cols[1], " ", 2)
-
-					r, found := s.rooms[cols[0]]
+					r, found := s.Room(params[0])
 					if !found {
-						err := cli.ReplyNoChannel(cols[0])
+						err := cli.ReplyNoChannel(params[0])
 						if err != nil {
 							return err
 						}
@@ -421,25 +716,35 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					var change string
-
-					if len(cols) > 1 {
-						change = cols[1]
-					} else {
-						change = ""
-					}
-
-					s.roomCh[r] <- client.Event{
+					s.SendRoom(r, client.Event{
 						Client:    cli,
 						EventType: client.EventTopic,
-						Text:      change,
+						Message:   msg,
+					})
+				case "UNDLINE", "UNKLINE":
+					s.HandlerUnLine(cli, command, params)
+
+				case "USERHOST":
+					if len(params) == 0 {
+						err := cli.ReplyNotEnoughParameters("USERHOST")
+						if err != nil {
+							return err
+						}
+
+						continue
 					}
+
+					s.SendUserhost(cli, strings.Fields(strings.Join(params, " ")))
+
+				case "WALLOPS":
+					s.HandlerWallops(cli, params)
+
 				case "WHO":
-					if len(cols) == 1 || len(cols[1]) < 1 {
+					if len(params) == 0 {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("WHO not enough parameters")
 						err := cli.ReplyNotEnoughParameters("WHO")
@@ -450,9 +755,9 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					rm := strings.Split(cols[1], " ")[0]
+					rm := params[0]
 
-					r, found := s.rooms[rm]
+					r, found := s.Room(rm)
 					if !found {
 						err := cli.ReplyNoChannel(rm)
 						if err != nil {
@@ -461,18 +766,17 @@ func (s *Server) Start(ctx context.Context) error {
 
 						continue
 					}
-					s.roomCh[r] <- client.Event{
+					s.SendRoom(r, client.Event{
 						Client:    cli,
 						EventType: client.EventWho,
-						Text:      "",
-					}
+					})
 
 				case "WHOIS":
-					if len(cols) == 1 || len(cols[1]) < 1 {
+					if len(params) == 0 {
 						s.log.Debug().Dict("details",
 							zerolog.Dict().
 								Str("type", ev.EventType.String()).
-								Str("text", ev.Text).
+								Str("text", ev.Message.String()).
 								Str("remote", ev.Client.RemoteHost),
 						).Msg("WHOIS not enough parameters")
 						err := cli.ReplyNotEnoughParameters("WHOIS")
@@ -483,17 +787,16 @@ func (s *Server) Start(ctx context.Context) error {
 						continue
 					}
 
-					cs := strings.Split(cols[1], " ")
-
-					nicknames := strings.Split(cs[len(cs)-1], ",")
-					go s.SendWhois(cli, nicknames)
+					// Optional server parameter comes first
+					nicknames := strings.Split(params[len(params)-1], ",")
+					s.SendWhois(cli, nicknames)
 				default:
 					s.log.Debug().Dict("details",
 						zerolog.Dict().
 							Str("client", ev.Client.RemoteHost).
-							Str("text", ev.Text).
+							Str("text", msg.String()).
 							Str("EvType", ev.EventType.String()),
-					).Msg(ev.Text)
+					).Msg(msg.String())
 					err := cli.ReplyNicknamed("421", command, "Unknown command")
 					if err != nil {
 						return err
@@ -504,10 +807,10 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
-func (s *Server) ClientRegister(cli *client.Client, command string, cols []string) {
+func (s *Server) ClientRegister(cli *client.Client, command string, params []string) {
 	switch command {
 	case "NICK":
-		if len(cols) == 1 || len(cols[1]) < 1 {
+		if len(params) == 0 || params[0] == "" {
 			s.log.Debug().Dict("details",
 				zerolog.Dict(),
 			).Msg("NICK no nickname given")
@@ -519,22 +822,20 @@ func (s *Server) ClientRegister(cli *client.Client, command string, cols []strin
 			return
 		}
 
-		nickname := cols[1]
-		for loopClient := range s.clients {
-			if loopClient.Nickname == nickname {
-				s.log.Info().Dict("details", zerolog.Dict().Str("nickname", nickname)).Msg("nickname is already in use")
-				err := cli.ReplyParts("433", "*", nickname, "Nickname is already in use")
-				if err != nil {
-					s.log.Err(err).Msg("cannot send message")
-				}
-
-				return
+		nickname := params[0]
+		if s.NicknameInUse(cli, nickname) {
+			s.log.Info().Dict("details", zerolog.Dict().Str("nickname", nickname)).Msg("nickname is already in use")
+			err := cli.ReplyParts("433", "*", nickname, "Nickname is already in use")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
 			}
+
+			return
 		}
 
 		if !ReNickname.MatchString(nickname) {
 			s.log.Info().Dict("details", zerolog.Dict().Str("nickname", nickname)).Msg("Erroneous nickname")
-			err := cli.ReplyParts("432", "*", cols[1], "Erroneous nickname")
+			err := cli.ReplyParts("432", "*", nickname, "Erroneous nickname")
 			if err != nil {
 				s.log.Err(err).Msg("cannot send message")
 			}
@@ -542,12 +843,8 @@ func (s *Server) ClientRegister(cli *client.Client, command string, cols []strin
 			return
 		}
 
-		cli.Nickname = nickname
-
-	case "USER":
-		if len(cols) == 1 {
-			err := cli.ReplyNotEnoughParameters("USER")
-			s.log.Info().Dict("details", zerolog.Dict()).Msg("USER not enough parameters")
+		if !s.CertNickAllowed(cli, nickname) {
+			err := cli.ReplyParts("432", "*", nickname, "Nickname must match your certificate")
 			if err != nil {
 				s.log.Err(err).Msg("cannot send message")
 			}
@@ -555,9 +852,10 @@ func (s *Server) ClientRegister(cli *client.Client, command string, cols []strin
 			return
 		}
 
-		args := strings.SplitN(cols[1], " ", 4)
+		cli.SetNickname(nickname)
 
-		if len(args) < 4 {
+	case "USER":
+		if len(params) < 4 {
 			err := cli.ReplyNotEnoughParameters("USER")
 			s.log.Info().Dict("details", zerolog.Dict()).Msg("USER not enough parameters")
 			if err != nil {
@@ -567,21 +865,44 @@ func (s *Server) ClientRegister(cli *client.Client, command string, cols []strin
 			return
 		}
 
-		cli.Username = args[0]
-		cli.Realname = strings.TrimLeft(args[3], ":")
+		cli.Username = params[0]
+		cli.Realname = params[3]
+	}
+
+	s.CompleteRegistration(cli)
+}
+
+// Welcome the client once both nickname and username are known and
+// capability negotiation, if any, has ended.
+func (s *Server) CompleteRegistration(cli *client.Client) {
+	if cli.Registered || cli.Negotiating {
+		return
 	}
 
-	if cli.Nickname != "*" && cli.Username != "" {
+	if cli.Nickname() != "*" && cli.Username != "" {
 		var err error
 
+		if s.KLined(cli) {
+			return
+		}
+
+		if cli.Account == "" && s.Config().CertAuth.AutoLogin {
+			if cert := cli.Certificate(); cert != nil {
+				if name, found := s.Config().CertAuth.Account(cert); found {
+					s.LoginAccount(cli, name)
+				}
+			}
+		}
+
 		cli.Registered = true
+		s.MonitorOnline(cli)
 
 		err = cli.ReplyNicknamed("001", "Hi, welcome to IRC")
 		if err != nil {
 			s.log.Err(err).Msg("cannot send message")
 		}
 
-		err = cli.ReplyNicknamed("002", "Your host is "+s.config.Hostname+", running goircd")
+		err = cli.ReplyNicknamed("002", "Your host is "+s.Config().Hostname+", running goircd")
 		if err != nil {
 			s.log.Err(err).Msg("cannot send message")
 		}
@@ -591,11 +912,13 @@ func (s *Server) ClientRegister(cli *client.Client, command string, cols []strin
 			s.log.Err(err).Msg("cannot send message")
 		}
 
-		err = cli.ReplyNicknamed("004", s.config.Hostname+" goircd o o")
+		err = cli.ReplyNicknamed("004", s.Config().Hostname, "goircd", client.UserModes, ChannelModes(), ChannelModesWithParam())
 		if err != nil {
 			s.log.Err(err).Msg("cannot send message")
 		}
 
+		s.SendISupport(cli)
+
 		s.SendLusers(cli)
 		s.SendMotd(cli)
 	}
@@ -619,12 +942,47 @@ func (s *Server) CheckAliveness(ctx context.Context) {
 func (s *Server) Stop(ctx context.Context) error {
 	if s.isStarted {
 		s.isStarted = false
+
+		err := s.listener.Close()
+		if err != nil {
+			s.log.Err(err).Msg("closing listener")
+		}
+
+		for c := range s.clients {
+			err = c.Msg("ERROR :Server shutting down")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			err = c.Stop(ctx)
+			if err != nil {
+				s.log.Err(err).Msg("cannot stop client")
+			}
+		}
+
+		s.WaitFlushed()
 		s.log.Info().Msg("stopped")
 	}
 
 	return nil
 }
 
+// Wait for clients to write what was queued for them, ERROR included,
+// but not longer than ShutdownTimeout.
+func (s *Server) WaitFlushed() {
+	deadline := time.After(ShutdownTimeout)
+
+	for c := range s.clients {
+		select {
+		case <-c.Flushed():
+		case <-deadline:
+			s.log.Info().Msg("clients not flushed in time")
+
+			return
+		}
+	}
+}
+
 func (s *Server) handleNewConnection(ctx context.Context) {
 	for {
 		conn, err := s.listener.Accept()
@@ -632,19 +990,25 @@ func (s *Server) handleNewConnection(ctx context.Context) {
 			return
 		}
 
+		if s.DLined(conn) || s.OverLimits(conn) {
+			continue
+		}
+
 		remoteHost := conn.RemoteAddr().String()
 		s.log.Debug().Dict("details", zerolog.Dict().Str("remote", remoteHost)).Msgf("connected")
 
 		cli, err := client.New(
-			client.Hostname(s.config.Hostname),
+			client.Hostname(s.Config().Hostname),
 			client.Name(remoteHost),
 			client.Connection(conn),
 			client.Events(s.events),
 			client.Logger(s.log),
-			client.Config((s.config)),
+			client.Config(s.Config()),
 		)
 		if err != nil {
 			s.log.Err(err).Dict("details", zerolog.Dict().Str("remote", remoteHost)).Msg("error")
+			s.limits.release(remoteHost)
+
 			continue
 		}
 
@@ -653,22 +1017,41 @@ func (s *Server) handleNewConnection(ctx context.Context) {
 }
 
 func (s *Server) SendLusers(cli *client.Client) {
-	lusers := 0
+	var users, invisible, operators, unknown int
 
 	for tmpCli := range s.clients {
-		if tmpCli.Registered {
-			lusers++
+		switch {
+		case !tmpCli.Registered:
+			unknown++
+		case tmpCli.Invisible():
+			invisible++
+		default:
+			users++
+		}
+
+		if tmpCli.Registered && tmpCli.Operator {
+			operators++
 		}
 	}
 
-	err := cli.ReplyNicknamed("251", fmt.Sprintf("There are %d users and 0 invisible on 1 servers", lusers))
-	if err != nil {
-		s.log.Err(err).Msg("cannot send message")
+	replies := [][]string{
+		{"251", fmt.Sprintf("There are %d users and %d invisible on 1 servers", users, invisible)},
+		{"252", strconv.Itoa(operators), "operator(s) online"},
+		{"253", strconv.Itoa(unknown), "unknown connection(s)"},
+		{"254", strconv.Itoa(len(s.rooms)), "channels formed"},
+		{"255", fmt.Sprintf("I have %d clients and 1 servers", users+invisible)},
+	}
+
+	for _, reply := range replies {
+		err := cli.ReplyNicknamed(reply[0], reply[1:]...)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
 	}
 }
 
 func (s *Server) SendMotd(cli *client.Client) {
-	if s.config.Motd == "" {
+	if s.Config().Motd == "" {
 		err := cli.ReplyNicknamed("422", "MOTD File is missing")
 		if err != nil {
 			s.log.Err(err).Msg("cannot send message")
@@ -677,9 +1060,9 @@ func (s *Server) SendMotd(cli *client.Client) {
 		return
 	}
 
-	motd, err := os.ReadFile(s.config.Motd)
+	motd, err := os.ReadFile(s.Config().Motd)
 	if err != nil {
-		s.log.Err(err).Msgf("Can not read motd file %s", s.config.Motd)
+		s.log.Err(err).Msgf("Can not read motd file %s", s.Config().Motd)
 
 		err = cli.ReplyNicknamed("422", "Error reading MOTD File")
 		if err != nil {
@@ -689,7 +1072,7 @@ func (s *Server) SendMotd(cli *client.Client) {
 		return
 	}
 
-	err = cli.ReplyNicknamed("375", "- "+s.config.Hostname+" Message of the day -")
+	err = cli.ReplyNicknamed("375", "- "+s.Config().Hostname+" Message of the day -")
 	if err != nil {
 		s.log.Err(err).Msg("cannot send message")
 	}
@@ -707,14 +1090,14 @@ func (s *Server) SendMotd(cli *client.Client) {
 	}
 }
 
-func (s *Server) HandlerJoin(cli *client.Client, cmd string) {
+// JOIN comma separated rooms with matching comma separated keys, if any.
+func (s *Server) HandlerJoin(cli *client.Client, names, roomKeys string) {
 	var keys []string
 
-	args := strings.Split(cmd, " ")
-	rooms := strings.Split(args[0], ",")
+	rooms := strings.Split(names, ",")
 
-	if len(args) > 1 {
-		keys = strings.Split(args[1], ",")
+	if roomKeys != "" {
+		keys = strings.Split(roomKeys, ",")
 	} else {
 		keys = []string{}
 	}
@@ -738,53 +1121,215 @@ func (s *Server) HandlerJoin(cli *client.Client, cmd string) {
 			key = ""
 		}
 
-		denied := false
-		joined := false
-
-		for existingRoom, roomCh := range s.roomCh {
-			if r == existingRoom.Name {
-				if (existingRoom.Key != "") && (existingRoom.Key != key) {
-					denied = true
-				} else {
-					s.log.Debug().
-						Dict("details", zerolog.Dict().
-							Str("channel", r).
-							Str("client", cli.RemoteHost)).
-						Msg("sending event to join client to room")
-					roomCh <- client.Event{
-						Client:    cli,
-						Text:      "",
-						EventType: client.EventNew,
-					}
-					joined = true
-				}
+		// Room checks its modes itself, founder's key locks a new one
+		join := client.Event{
+			Client:    cli,
+			Message:   message.New("", "JOIN", r, key),
+			EventType: client.EventNew,
+		}
 
-				break
-			}
+		if existingRoom, found := s.Room(r); found {
+			s.log.Debug().
+				Dict("details", zerolog.Dict().
+					Str("channel", r).
+					Str("client", cli.RemoteHost)).
+				Msg("sending event to join client to room")
+			s.SendRoom(existingRoom, join)
+
+			continue
 		}
 
-		if denied {
-			err := cli.ReplyNicknamed("475", r, "Cannot join channel (+k) - bad key")
+		newRoom, _ := s.RoomRegister(r)
+		s.SendRoom(newRoom, join)
+	}
+}
+
+// Change nickname of an already registered client. Everybody sharing a room
+// with it, the client itself included, is notified exactly once.
+func (s *Server) HandlerNick(cli *client.Client, params []string) {
+	if len(params) == 0 || params[0] == "" {
+		err := cli.ReplyNicknamed("431", "No nickname given")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	nickname := params[0]
+	if nickname == cli.Nickname() {
+		return
+	}
+
+	if s.NicknameInUse(cli, nickname) {
+		s.log.Info().Dict("details", zerolog.Dict().Str("nickname", nickname)).Msg("nickname is already in use")
+		err := cli.ReplyNicknamed("433", nickname, "Nickname is already in use")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	if !ReNickname.MatchString(nickname) {
+		s.log.Info().Dict("details", zerolog.Dict().Str("nickname", nickname)).Msg("Erroneous nickname")
+		err := cli.ReplyNicknamed("432", nickname, "Erroneous nickname")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	if !s.CertNickAllowed(cli, nickname) {
+		err := cli.ReplyNicknamed("432", nickname, "Nickname must match your certificate")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	// Prefix must be built before the change, it carries the old nickname
+	msg := message.New(cli.String(), "NICK", nickname).String()
+	tags := message.Tags{}.WithTime(time.Now())
+	peers := s.Peers(cli)
+
+	old := cli.Nickname()
+	cli.SetNickname(nickname)
+
+	for peer := range peers {
+		send := peer.MsgTagged
+		if peer == cli {
+			send = peer.RespondTagged
+		}
+
+		err := send(tags, msg)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+
+	if !strings.EqualFold(old, nickname) {
+		s.MonitorOffline(old)
+		s.MonitorOnline(cli)
+	}
+}
+
+// Forget the client which quit, was killed or lost its connection, telling
+// its peers. Called for both, as the connection is lost after QUIT too, but
+// acts only once.
+func (s *Server) ClientGone(cli *client.Client, reason string) {
+	if _, found := s.clients[cli]; !found {
+		return
+	}
+
+	delete(s.clients, cli)
+	delete(s.sasl, cli)
+	delete(s.saslFailures, cli)
+	delete(s.operFailures, cli)
+	delete(s.operChecks, cli)
+	s.limits.release(cli.RemoteHost)
+
+	if cli.Registered {
+		msg := message.New(cli.String(), "QUIT", reason).String()
+
+		for peer := range s.Peers(cli) {
+			if peer == cli {
+				continue
+			}
+
+			err := peer.Msg(msg)
 			if err != nil {
 				s.log.Err(err).Msg("cannot send message")
 			}
 		}
 
-		if denied || joined {
-			continue
+		for _, r := range s.rooms {
+			if _, subscribed := r.Membership(cli); subscribed {
+				s.SendRoom(r, client.Event{Client: cli, EventType: client.EventQuit})
+			}
+		}
+	}
+
+	s.MonitorForget(cli)
+
+	if cli.Registered {
+		s.MonitorOffline(cli.Nickname())
+	}
+}
+
+// Mark client as away with the given message or back when it is empty.
+// Peers which negotiated away-notify are told about the change.
+func (s *Server) HandlerAway(cli *client.Client, text string) {
+	if len(text) > client.AwayMaxLength {
+		text = text[:client.AwayMaxLength]
+	}
+
+	cli.SetAwayMessage(text)
+
+	var err error
+
+	if text == "" {
+		err = cli.ReplyNicknamed("305", "You are no longer marked as being away")
+	} else {
+		err = cli.ReplyNicknamed("306", "You have been marked as being away")
+	}
+
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	for peer := range s.Peers(cli) {
+		err = cli.SendAwayNotify(peer)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
 		}
+	}
+}
 
-		newRoom, roomCh := s.RoomRegister(r)
-		if key != "" {
-			newRoom.Key = key
+// Check whether nickname is taken by any client other than cli. Nicknames
+// differing only in case are considered the same.
+func (s *Server) NicknameInUse(cli *client.Client, nickname string) bool {
+	for c := range s.clients {
+		if c != cli && strings.EqualFold(c.Nickname(), nickname) {
+			return true
 		}
+	}
 
-		roomCh <- client.Event{
-			Client:    cli,
-			Text:      "",
-			EventType: client.EventNew,
+	return false
+}
+
+// Find a room by its name. Names differing only in case are the same, as
+// advertised with CASEMAPPING.
+func (s *Server) Room(name string) (*room.Room, bool) {
+	r, found := s.rooms[room.Fold(name)]
+
+	return r, found
+}
+
+// Find a registered client by its nickname.
+func (s *Server) Client(nickname string) *client.Client {
+	for c := range s.clients {
+		if c.Registered && strings.EqualFold(c.Nickname(), nickname) {
+			return c
 		}
 	}
+
+	return nil
+}
+
+// Collect every client sharing at least one room with cli, cli included.
+func (s *Server) Peers(cli *client.Client) map[*client.Client]bool {
+	peers := map[*client.Client]bool{cli: true}
+
+	for _, r := range s.rooms {
+		for _, member := range r.MembersSharedWith(cli) {
+			peers[member] = true
+		}
+	}
+
+	return peers
 }
 
 // Register new room in Daemon. Create an object, events sink, save pointers
@@ -793,14 +1338,14 @@ func (s *Server) RoomRegister(name string) (newRoom *room.Room, roomCh chan clie
 	roomCh = make(chan client.Event)
 
 	newRoom, _ = room.New(
-		room.Hostname(s.config.Hostname),
+		room.Hostname(s.Config().Hostname),
 		room.Name(name),
-		room.Config(s.config),
+		room.Config(s.Config()),
 		room.Logger(s.log),
 		room.Events(roomCh),
 	)
 
-	s.rooms[name] = newRoom
+	s.rooms[room.Fold(name)] = newRoom
 	s.roomCh[newRoom] = roomCh
 
 	go newRoom.Start(context.Background())
@@ -814,9 +1359,9 @@ func (s *Server) RoomFortNats(natRoom config.NatsChannel) {
 	roomCh := make(chan client.Event)
 
 	newRoom, _ := room.New(
-		room.Hostname(s.config.Hostname),
+		room.Hostname(s.Config().Hostname),
 		room.Name(natRoom.Name),
-		room.Config(s.config),
+		room.Config(s.Config()),
 		room.Nats(&natRoom),
 		room.Logger(s.log),
 		room.Events(roomCh),
@@ -824,18 +1369,42 @@ func (s *Server) RoomFortNats(natRoom config.NatsChannel) {
 
 	s.log.Debug().Msgf("room ch %v", roomCh)
 
-	s.rooms[natRoom.Name] = newRoom
+	s.rooms[room.Fold(natRoom.Name)] = newRoom
 	s.roomCh[newRoom] = roomCh
 
 	go newRoom.Start(context.Background())
 
 }
 
-func (s *Server) SendList(cli *client.Client, cols []string) {
+// Answer NAMES without parameters: members of every room cli may see, in
+// name order, ended by a single "366 *". Rooms hidden from cli send
+// nothing.
+func (s *Server) SendNamesAll(cli *client.Client) {
+	rooms := make([]string, 0, len(s.rooms))
+	for rm := range s.rooms {
+		rooms = append(rooms, rm)
+	}
+
+	sort.Strings(rooms)
+
+	for _, rm := range rooms {
+		r := s.rooms[rm]
+
+		s.SendRoom(r, client.Event{Client: cli, Message: message.New("", "NAMES"), EventType: client.EventNames})
+		s.SyncRoom(r, cli)
+	}
+
+	err := cli.ReplyNicknamed("366", "*", "End of NAMES list")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+func (s *Server) SendList(cli *client.Client, params []string) {
 	var rooms []string
 
-	if (len(cols) > 1) && (cols[1] != "") {
-		rooms = strings.Split(strings.Split(cols[1], " ")[0], ",")
+	if len(params) > 0 && params[0] != "" {
+		rooms = strings.Split(params[0], ",")
 	} else {
 		rooms = []string{}
 		for rm := range s.rooms {
@@ -845,10 +1414,15 @@ func (s *Server) SendList(cli *client.Client, cols []string) {
 
 	sort.Strings(rooms)
 
-	for _, room := range rooms {
-		r, found := s.rooms[room]
+	for _, name := range rooms {
+		r, found := s.Room(name)
 		if found {
-			err := cli.ReplyNicknamed("322", room, fmt.Sprintf("%d", len(r.Members)), r.Topic)
+			members, topic, listed := r.Listing(cli)
+			if !listed {
+				continue
+			}
+
+			err := cli.ReplyNicknamed("322", r.Name, fmt.Sprintf("%d", members), topic)
 			if err != nil {
 				s.log.Err(err).Msg("cannot send message")
 			}
@@ -861,6 +1435,56 @@ func (s *Server) SendList(cli *client.Client, cols []string) {
 	}
 }
 
+// Send 303 with those of the nicknames being online.
+func (s *Server) SendIson(cli *client.Client, nicknames []string) {
+	online := []string{}
+
+	for _, nickname := range nicknames {
+		if c := s.Client(nickname); c != nil {
+			online = append(online, c.Nickname())
+		}
+	}
+
+	err := cli.ReplyNicknamed("303", strings.Join(online, " "))
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Send 302 with nick=+user@host of up to five nicknames, "-" instead of
+// "+" marking away ones.
+func (s *Server) SendUserhost(cli *client.Client, nicknames []string) {
+	if len(nicknames) > UserhostMaxTargets {
+		nicknames = nicknames[:UserhostMaxTargets]
+	}
+
+	replies := []string{}
+
+	for _, nickname := range nicknames {
+		c := s.Client(nickname)
+		if c == nil {
+			continue
+		}
+
+		away := "+"
+		if c.IsAway() {
+			away = "-"
+		}
+
+		operator := ""
+		if c.Operator {
+			operator = "*"
+		}
+
+		replies = append(replies, c.Nickname()+operator+"="+away+c.Username+"@"+c.Host())
+	}
+
+	err := cli.ReplyNicknamed("302", strings.Join(replies, " "))
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
 func (s *Server) SendWhois(cli *client.Client, nicknames []string) {
 	for _, nickname := range nicknames {
 		nickname = strings.ToLower(nickname)
@@ -868,7 +1492,7 @@ func (s *Server) SendWhois(cli *client.Client, nicknames []string) {
 		found := false
 
 		for c := range s.clients {
-			if !strings.EqualFold(c.Nickname, nickname) {
+			if !strings.EqualFold(c.Nickname(), nickname) {
 				continue
 			}
 
@@ -881,34 +1505,50 @@ func (s *Server) SendWhois(cli *client.Client, nicknames []string) {
 				h = "Unknown"
 			}
 
-			err = cli.ReplyNicknamed("311", c.Nickname, c.Username, h, "*", c.Realname)
+			err = cli.ReplyNicknamed("311", c.Nickname(), c.Username, h, "*", c.Realname)
 			if err != nil {
 				s.log.Err(err).Msg("cannot send command")
 			}
 
-			err = cli.ReplyNicknamed("312", c.Nickname, s.config.Hostname, s.config.Hostname)
+			err = cli.ReplyNicknamed("312", c.Nickname(), s.Config().Hostname, s.Config().Hostname)
 			if err != nil {
 				s.log.Err(err).Msg("cannot send command")
 			}
 
+			if c.IsAway() {
+				err = cli.ReplyNicknamed("301", c.Nickname(), c.AwayMessage())
+				if err != nil {
+					s.log.Err(err).Msg("cannot send command")
+				}
+			}
+
+			if c.Account != "" {
+				err = cli.ReplyNicknamed("330", c.Nickname(), c.Account, "is logged in as")
+				if err != nil {
+					s.log.Err(err).Msg("cannot send command")
+				}
+			}
+
 			subscriptions := []string{}
 
 			for _, room := range s.rooms {
-				for subscriber := range room.Members {
-					if subscriber.Nickname == nickname {
-						subscriptions = append(subscriptions, room.Name)
-					}
+				if !room.VisibleTo(cli) {
+					continue
+				}
+
+				if privilege, subscribed := room.Membership(c); subscribed {
+					subscriptions = append(subscriptions, privilege.Prefix()+room.Name)
 				}
 			}
 
 			sort.Strings(subscriptions)
 
-			err = cli.ReplyNicknamed("319", c.Nickname, strings.Join(subscriptions, " "))
+			err = cli.ReplyNicknamed("319", c.Nickname(), strings.Join(subscriptions, " "))
 			if err != nil {
 				s.log.Err(err).Msg("cannot send command")
 			}
 
-			err = cli.ReplyNicknamed("318", c.Nickname, "End of /WHOIS list")
+			err = cli.ReplyNicknamed("318", c.Nickname(), "End of /WHOIS list")
 			if err != nil {
 				s.log.Err(err).Msg("cannot send command")
 			}
@@ -0,0 +1,72 @@
+package ircd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/room"
+)
+
+const (
+	ISupportPerLine = 13 // Max tokens in a single 005 reply
+)
+
+// RPL_ISUPPORT tokens. They are derived from the very constants the server
+// enforces, so they change together with the limits.
+func (s *Server) ISupport() []string {
+	return []string{
+		"AWAYLEN=" + strconv.Itoa(client.AwayMaxLength),
+		"CASEMAPPING=ascii",
+		"CHANMODES=" + strings.Join([]string{room.ListModes, "k", "l", room.FlagModes}, ","),
+		"CHANNELLEN=" + strconv.Itoa(len("#")+room.NameMaxLength),
+		"CHANTYPES=#",
+		"CHATHISTORY=" + strconv.Itoa(room.HistoryMaxLimit),
+		"EXCEPTS=" + string(room.ModeExcept),
+		"INVEX=" + string(room.ModeInviteExcept),
+		"MAXLIST=" + room.ListModes + ":" + strconv.Itoa(room.MaxListEntries),
+		"MODES=" + strconv.Itoa(room.MaxModeChanges),
+		"MONITOR=" + strconv.Itoa(MonitorMaxTargets),
+		"MSGREFTYPES=msgid,timestamp",
+		"NICKLEN=" + strconv.Itoa(NicknameMaxLength),
+		"PREFIX=(" + room.PrivilegeModes + ")" + room.PrivilegePrefixes,
+		"TOPICLEN=" + strconv.Itoa(room.TopicMaxLength),
+	}
+}
+
+// Send ISUPPORT tokens split over as many 005 replies as needed.
+func (s *Server) SendISupport(cli *client.Client) {
+	tokens := s.ISupport()
+
+	for len(tokens) > 0 {
+		n := ISupportPerLine
+		if n > len(tokens) {
+			n = len(tokens)
+		}
+
+		err := cli.ReplyNicknamed("005", append(tokens[:n:n], "are supported by this server")...)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		tokens = tokens[n:]
+	}
+}
+
+// All channel modes, as advertised in 004 reply.
+func ChannelModes() string {
+	return sortedModes(room.ListModes + "kl" + room.FlagModes + room.PrivilegeModes)
+}
+
+// Channel modes taking a parameter, as advertised in 004 reply.
+func ChannelModesWithParam() string {
+	return sortedModes(room.ListModes + "kl" + room.PrivilegeModes)
+}
+
+func sortedModes(modes string) string {
+	chars := strings.Split(modes, "")
+	sort.Strings(chars)
+
+	return strings.Join(chars, "")
+}
@@ -0,0 +1,42 @@
+package ircd
+
+import (
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/room"
+)
+
+// Send event to the room. Rooms handling a labelled command are remembered,
+// its response is complete only after they are done.
+func (s *Server) SendRoom(r *room.Room, ev client.Event) {
+	s.roomCh[r] <- ev
+
+	if s.labeled != nil {
+		s.labelRooms[r] = true
+	}
+}
+
+// Wait until the room handled all events sent to it before. Rooms receive
+// events one by one, so a room accepting EventSync is done with them.
+func (s *Server) SyncRoom(r *room.Room, cli *client.Client) {
+	s.roomCh[r] <- client.Event{Client: cli, EventType: client.EventSync}
+}
+
+// Wait for rooms to handle the labelled command and send its response.
+func (s *Server) EndLabel() {
+	if s.labeled == nil {
+		return
+	}
+
+	for r := range s.labelRooms {
+		s.SyncRoom(r, s.labeled)
+
+		delete(s.labelRooms, r)
+	}
+
+	err := s.labeled.EndLabel()
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.labeled = nil
+}
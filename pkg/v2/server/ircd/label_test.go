@@ -0,0 +1,29 @@
+package ircd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelledOper(t *testing.T) {
+	s := newOperTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("CAP REQ :labeled-response batch")
+	alice.expect("ACK")
+
+	// Password is checked off the main loop, the response waits for it
+	alice.send("@label=wrong OPER admin nope")
+	require.True(t, strings.HasPrefix(alice.expect(" 464 "), "@label=wrong "))
+
+	alice.send("@label=right OPER admin secret")
+
+	lines := alice.readUntil("BATCH -")
+	require.Len(t, lines, 4)
+	require.True(t, strings.HasPrefix(lines[0], "@label=right "), lines[0])
+	require.Contains(t, lines[0], "BATCH +")
+	require.Contains(t, lines[1], " 381 alice ")
+	require.Contains(t, lines[2], " MODE alice +o")
+}
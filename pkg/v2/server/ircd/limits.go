@@ -0,0 +1,182 @@
+package ircd
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+)
+
+const (
+	IPv4DefaultPrefix = 32 // Network size counted for IPv4 sources unless configured
+	IPv6DefaultPrefix = 64 // Network size counted for IPv6 sources unless configured
+)
+
+// Connections counted against the limits, shared by the accepting goroutine
+// and the main loop.
+type connLimits struct {
+	mu       sync.Mutex
+	cfg      config.Connections
+	total    int
+	perIP    map[string]int
+	perNet   map[string]int
+	conns    map[string]connSource  // Sources of accepted connections by remote address
+	connects map[string][]time.Time // Recent connections of each network
+	swept    time.Time
+}
+
+// Where a connection came from, as counted.
+type connSource struct {
+	ip, network string
+}
+
+func newConnLimits(cfg config.Connections) *connLimits {
+	return &connLimits{
+		cfg:      cfg,
+		perIP:    make(map[string]int),
+		perNet:   make(map[string]int),
+		conns:    make(map[string]connSource),
+		connects: make(map[string][]time.Time),
+	}
+}
+
+// Apply limits read anew, connections already accepted stay.
+func (l *connLimits) configure(cfg config.Connections) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+}
+
+// Network of ip counted against the per network limits.
+func (l *connLimits) network(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		prefix := l.cfg.IPv4Prefix
+		if prefix <= 0 || prefix > 32 {
+			prefix = IPv4DefaultPrefix
+		}
+
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(prefix, 32)), Mask: net.CIDRMask(prefix, 32)}).String()
+	}
+
+	prefix := l.cfg.IPv6Prefix
+	if prefix <= 0 || prefix > 128 {
+		prefix = IPv6DefaultPrefix
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, 128)), Mask: net.CIDRMask(prefix, 128)}).String()
+}
+
+// Count the connection from remote if the limits allow it. Otherwise tell
+// the reason it is refused for.
+func (l *connLimits) admit(remote string, ip net.IP, now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxClients > 0 && l.total >= l.cfg.MaxClients {
+		return "Server is full", false
+	}
+
+	source := connSource{ip: ip.String(), network: l.network(ip)}
+
+	if !l.cfg.Exempted(ip) {
+		if l.cfg.PerIP > 0 && l.perIP[source.ip] >= l.cfg.PerIP {
+			return "Too many connections from your host", false
+		}
+
+		if l.cfg.PerNetwork > 0 && l.perNet[source.network] >= l.cfg.PerNetwork {
+			return "Too many connections from your network", false
+		}
+
+		if !l.throttle(source.network, now) {
+			return "Connecting too fast, try again later", false
+		}
+	}
+
+	l.total++
+	l.perIP[source.ip]++
+	l.perNet[source.network]++
+	l.conns[remote] = source
+
+	return "", true
+}
+
+// Record connection attempt from network, false if it already made as many
+// as allowed within the throttle window. Caller holds l.mu.
+func (l *connLimits) throttle(network string, now time.Time) bool {
+	if l.cfg.Throttle <= 0 || l.cfg.ThrottleWindow <= 0 {
+		return true
+	}
+
+	since := now.Add(-l.cfg.ThrottleWindow)
+
+	// Networks which stopped connecting are forgotten now and then
+	if l.swept.Before(since) {
+		for other, times := range l.connects {
+			if times[len(times)-1].Before(since) {
+				delete(l.connects, other)
+			}
+		}
+
+		l.swept = now
+	}
+
+	recent := l.connects[network]
+	for len(recent) > 0 && recent[0].Before(since) {
+		recent = recent[1:]
+	}
+
+	if len(recent) >= l.cfg.Throttle {
+		l.connects[network] = recent
+
+		return false
+	}
+
+	l.connects[network] = append(recent, now)
+
+	return true
+}
+
+// Stop counting the connection from remote once it is gone.
+func (l *connLimits) release(remote string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	source, found := l.conns[remote]
+	if !found {
+		return
+	}
+
+	delete(l.conns, remote)
+	l.total--
+
+	if l.perIP[source.ip]--; l.perIP[source.ip] <= 0 {
+		delete(l.perIP, source.ip)
+	}
+
+	if l.perNet[source.network]--; l.perNet[source.network] <= 0 {
+		delete(l.perNet, source.network)
+	}
+}
+
+// Check connection limits for a connection just accepted, closing it if
+// they are exceeded.
+func (s *Server) OverLimits(conn net.Conn) bool {
+	remote := conn.RemoteAddr().String()
+
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		host = remote
+	}
+
+	reason, ok := s.limits.admit(remote, net.ParseIP(host), time.Now())
+	if ok {
+		return false
+	}
+
+	s.log.Info().Str("remote", host).Str("reason", reason).Msg("connection refused")
+	s.RefuseConnection(conn, host, reason)
+
+	return true
+}
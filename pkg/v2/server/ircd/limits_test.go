@@ -0,0 +1,179 @@
+package ircd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnLimits(t *testing.T) {
+	type step struct {
+		remote  string
+		release bool          // Release the connection instead of admitting it
+		after   time.Duration // Time since the first step
+		reason  string        // Expected refusal, empty if admitted
+	}
+
+	tests := []struct {
+		name  string
+		cfg   config.Connections
+		steps []step
+	}{
+		{
+			name: "no limits",
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.1:2"},
+				{remote: "192.0.2.1:3"},
+			},
+		},
+		{
+			name: "max clients",
+			cfg:  config.Connections{MaxClients: 2},
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.2:1"},
+				{remote: "192.0.2.3:1", reason: "Server is full"},
+				{remote: "192.0.2.1:1", release: true},
+				{remote: "192.0.2.3:1"},
+			},
+		},
+		{
+			name: "per IP",
+			cfg:  config.Connections{PerIP: 2},
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.1:2"},
+				{remote: "192.0.2.1:3", reason: "Too many connections from your host"},
+				{remote: "192.0.2.2:1"},
+				{remote: "192.0.2.1:2", release: true},
+				{remote: "192.0.2.1:3"},
+			},
+		},
+		{
+			name: "per IPv6 /64 by default",
+			cfg:  config.Connections{PerNetwork: 2},
+			steps: []step{
+				{remote: "[2001:db8::1]:1"},
+				{remote: "[2001:db8::2]:1"},
+				{remote: "[2001:db8::3]:1", reason: "Too many connections from your network"},
+				{remote: "[2001:db8:0:1::1]:1"},
+				// IPv4 networks are single addresses by default
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.2:1"},
+				{remote: "192.0.2.1:2"},
+				{remote: "192.0.2.1:3", reason: "Too many connections from your network"},
+			},
+		},
+		{
+			name: "configured network sizes",
+			cfg:  config.Connections{PerNetwork: 1, IPv4Prefix: 24, IPv6Prefix: 48},
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.200:1", reason: "Too many connections from your network"},
+				{remote: "198.51.100.1:1"},
+				{remote: "[2001:db8::1]:1"},
+				{remote: "[2001:db8:0:1::1]:1", reason: "Too many connections from your network"},
+				{remote: "[2001:db8:1::1]:1"},
+			},
+		},
+		{
+			name: "exempt hosts",
+			cfg:  config.Connections{MaxClients: 5, PerIP: 1, Throttle: 1, ThrottleWindow: time.Minute, Exempt: []string{"10.0.0.0/8"}},
+			steps: []step{
+				{remote: "10.1.2.3:1"},
+				{remote: "10.1.2.3:2"},
+				{remote: "10.1.2.3:3"},
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.1:2", reason: "Too many connections from your host"},
+				{remote: "10.1.2.3:4"},
+				// Exempt hosts still count against the global cap
+				{remote: "10.1.2.3:5", reason: "Server is full"},
+			},
+		},
+		{
+			name: "throttle window",
+			cfg:  config.Connections{Throttle: 2, ThrottleWindow: 10 * time.Second},
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.1:2", after: time.Second},
+				{remote: "192.0.2.1:3", after: 2 * time.Second, reason: "Connecting too fast, try again later"},
+				// Refused attempts do not prolong the wait
+				{remote: "192.0.2.1:4", after: 10500 * time.Millisecond},
+				{remote: "192.0.2.1:5", after: 11500 * time.Millisecond},
+				{remote: "192.0.2.1:6", after: 11500 * time.Millisecond, reason: "Connecting too fast, try again later"},
+				{remote: "192.0.2.2:1", after: 11500 * time.Millisecond},
+			},
+		},
+		{
+			name: "throttle counts connections, not those open",
+			cfg:  config.Connections{Throttle: 1, ThrottleWindow: time.Minute},
+			steps: []step{
+				{remote: "192.0.2.1:1"},
+				{remote: "192.0.2.1:1", release: true},
+				{remote: "192.0.2.1:2", reason: "Connecting too fast, try again later"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConnLimits(tt.cfg)
+			start := time.Now()
+
+			for i, st := range tt.steps {
+				if st.release {
+					l.release(st.remote)
+
+					continue
+				}
+
+				host, _, err := net.SplitHostPort(st.remote)
+				require.NoError(t, err)
+
+				reason, ok := l.admit(st.remote, net.ParseIP(host), start.Add(st.after))
+				require.Equal(t, st.reason, reason, "step %d", i)
+				require.Equal(t, st.reason == "", ok, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestConnLimitsRelease(t *testing.T) {
+	l := newConnLimits(config.Connections{PerIP: 1})
+
+	_, ok := l.admit("192.0.2.1:1", net.ParseIP("192.0.2.1"), time.Now())
+	require.True(t, ok)
+
+	l.release("192.0.2.1:1")
+	// Unknown and repeated releases change nothing
+	l.release("192.0.2.1:1")
+	l.release("192.0.2.9:1")
+
+	require.Zero(t, l.total)
+	require.Empty(t, l.perIP)
+	require.Empty(t, l.perNet)
+	require.Empty(t, l.conns)
+}
+
+func TestConnLimitsSweep(t *testing.T) {
+	l := newConnLimits(config.Connections{Throttle: 5, ThrottleWindow: time.Minute})
+	start := time.Now()
+
+	for _, host := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		_, ok := l.admit(host+":1", net.ParseIP(host), start)
+		require.True(t, ok)
+	}
+
+	require.Len(t, l.connects, 3)
+
+	// Networks quiet for a whole window are forgotten by the next attempt
+	_, ok := l.admit("192.0.2.4:1", net.ParseIP("192.0.2.4"), start.Add(2*time.Minute))
+	require.True(t, ok)
+	require.Len(t, l.connects, 1)
+	require.Contains(t, l.connects, "192.0.2.4/32")
+}
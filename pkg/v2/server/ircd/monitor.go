@@ -0,0 +1,191 @@
+package ircd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+)
+
+const (
+	MonitorMaxTargets = 100 // Max nicknames a single client may monitor
+	MonitorLineLength = 400 // Max length of targets sent in a single reply
+)
+
+// MONITOR command: "+ targets", "- targets", "C", "L" or "S".
+func (s *Server) HandlerMonitor(cli *client.Client, args []string) {
+	if len(args) == 0 {
+		err := cli.ReplyNotEnoughParameters("MONITOR")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	targets := []string{}
+
+	if len(args) > 1 {
+		for _, target := range strings.Split(args[1], ",") {
+			if target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "+":
+		if len(targets) == 0 {
+			err := cli.ReplyNotEnoughParameters("MONITOR")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			return
+		}
+
+		s.MonitorAdd(cli, targets)
+	case "-":
+		for _, target := range targets {
+			s.MonitorRemove(cli, target)
+		}
+	case "C":
+		s.MonitorForget(cli)
+	case "L":
+		s.SendMonitorTargets(cli, "732", s.MonitorList(cli))
+
+		err := cli.ReplyNicknamed("733", "End of MONITOR list")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	case "S":
+		s.SendMonitorStatus(cli, s.MonitorList(cli))
+	default:
+		err := cli.ReplyNicknamed("421", "MONITOR "+args[0], "Unknown MONITOR subcommand")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
+
+// Add nicknames to the monitor list of cli and tell their current status.
+// Whatever does not fit into the list is reported with 734.
+func (s *Server) MonitorAdd(cli *client.Client, targets []string) {
+	added := []string{}
+
+	for i, target := range targets {
+		key := strings.ToLower(target)
+		if _, found := s.monitoring[cli][key]; found {
+			continue
+		}
+
+		if len(s.monitoring[cli]) >= MonitorMaxTargets {
+			err := cli.ReplyNicknamed("734", strconv.Itoa(MonitorMaxTargets), strings.Join(targets[i:], ","), "Monitor list is full")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			break
+		}
+
+		if s.monitoring[cli] == nil {
+			s.monitoring[cli] = make(map[string]string)
+		}
+
+		if s.monitors[key] == nil {
+			s.monitors[key] = make(map[*client.Client]bool)
+		}
+
+		s.monitoring[cli][key] = target
+		s.monitors[key][cli] = true
+
+		added = append(added, target)
+	}
+
+	s.SendMonitorStatus(cli, added)
+}
+
+// Remove nickname from the monitor list of cli.
+func (s *Server) MonitorRemove(cli *client.Client, target string) {
+	key := strings.ToLower(target)
+
+	delete(s.monitoring[cli], key)
+	delete(s.monitors[key], cli)
+
+	if len(s.monitoring[cli]) == 0 {
+		delete(s.monitoring, cli)
+	}
+
+	if len(s.monitors[key]) == 0 {
+		delete(s.monitors, key)
+	}
+}
+
+// Send 730 for those targets being online and 731 for the rest.
+func (s *Server) SendMonitorStatus(cli *client.Client, targets []string) {
+	online := []string{}
+	offline := []string{}
+
+	for _, target := range targets {
+		if c := s.Client(target); c != nil {
+			online = append(online, c.String())
+		} else {
+			offline = append(offline, target)
+		}
+	}
+
+	s.SendMonitorTargets(cli, "730", online)
+	s.SendMonitorTargets(cli, "731", offline)
+}
+
+// Send comma separated targets, split over as many replies as needed.
+func (s *Server) SendMonitorTargets(cli *client.Client, code string, targets []string) {
+	for len(targets) > 0 {
+		n, length := 0, 0
+		for n < len(targets) && (n == 0 || length+len(targets[n])+1 <= MonitorLineLength) {
+			length += len(targets[n]) + 1
+			n++
+		}
+
+		err := cli.ReplyNicknamed(code, strings.Join(targets[:n], ","))
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		targets = targets[n:]
+	}
+}
+
+// Tell everybody monitoring the nickname of cli that it came online.
+func (s *Server) MonitorOnline(cli *client.Client) {
+	for watcher := range s.monitors[strings.ToLower(cli.Nickname())] {
+		s.SendMonitorTargets(watcher, "730", []string{cli.String()})
+	}
+}
+
+// Tell everybody monitoring the nickname that it went offline.
+func (s *Server) MonitorOffline(nickname string) {
+	for watcher := range s.monitors[strings.ToLower(nickname)] {
+		s.SendMonitorTargets(watcher, "731", []string{nickname})
+	}
+}
+
+// Nicknames monitored by cli, sorted.
+func (s *Server) MonitorList(cli *client.Client) []string {
+	targets := []string{}
+	for _, target := range s.monitoring[cli] {
+		targets = append(targets, target)
+	}
+
+	sort.Strings(targets)
+
+	return targets
+}
+
+// Forget the monitor list of the client, it is gone.
+func (s *Server) MonitorForget(cli *client.Client) {
+	for _, target := range s.monitoring[cli] {
+		s.MonitorRemove(cli, target)
+	}
+}
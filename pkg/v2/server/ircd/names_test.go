@@ -0,0 +1,34 @@
+package ircd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserhost(t *testing.T) {
+	s := newTestServer(t)
+
+	dialTest(t, s, "alice")
+	dialTest(t, s, "bob")
+	carol := dialTest(t, s, "carol")
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{name: "parameters", command: "USERHOST alice bob", want: " 302 carol :alice=+alice@127.0.0.1 bob=+bob@127.0.0.1"},
+		{name: "trailing parameter", command: "USERHOST :alice bob", want: " 302 carol :alice=+alice@127.0.0.1 bob=+bob@127.0.0.1"},
+		{name: "unknown nickname", command: "USERHOST :nobody alice", want: " 302 carol alice=+alice@127.0.0.1"},
+		{name: "at most five", command: "USERHOST :x x x x x alice", want: " 302 carol :"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carol.t = t
+			carol.send(tt.command)
+			require.Equal(t, tt.want, carol.expect(" 302 ")[len(":"+s.Config().Hostname):])
+		})
+	}
+}
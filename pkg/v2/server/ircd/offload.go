@@ -0,0 +1,31 @@
+package ircd
+
+import "github.com/simplefxn/goircd/pkg/v2/server/client"
+
+// Run slow work for cli, such as checking a bcrypt hash, off the main loop
+// so that other clients are not held up. Work returns what has to be done
+// with its result, which the main loop runs unless cli is gone by then.
+// Response to a labelled command is completed only after that.
+func (s *Server) Offload(cli *client.Client, work func() func()) {
+	var rsp *client.Response
+	if s.labeled == cli {
+		rsp = cli.SuspendLabel()
+	}
+
+	go func() {
+		apply := work()
+
+		s.results <- func() {
+			if _, found := s.clients[cli]; !found {
+				return
+			}
+
+			if rsp != nil {
+				cli.ResumeLabel(rsp)
+				s.labeled = cli
+			}
+
+			apply()
+		}
+	}()
+}
@@ -0,0 +1,293 @@
+package ircd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/mask"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const OperMaxFailures = 3 // Failed OPER attempts before the client is disconnected
+
+// Reloadable is implemented by account stores which can re-read their
+// backing file on REHASH.
+type Reloadable interface {
+	Reload() error
+}
+
+// OPER name password.
+func (s *Server) HandlerOper(cli *client.Client, args []string) {
+	if len(args) < 2 {
+		err := cli.ReplyNotEnoughParameters("OPER")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	name, password := args[0], args[1]
+
+	oper, found := s.Config().Operator(name)
+	if !found || !s.OperHostAllowed(cli, oper) {
+		s.log.Info().Str("name", name).Str("remote", cli.RemoteHost).Msg("no operator block for host")
+
+		err := cli.ReplyNicknamed("491", "No O-lines for your host")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	// One check at a time, OPER sent meanwhile is ignored
+	if s.operChecks[cli] {
+		return
+	}
+
+	s.operChecks[cli] = true
+
+	// Hash is checked off the main loop, it takes a while on purpose
+	s.Offload(cli, func() func() {
+		err := bcrypt.CompareHashAndPassword([]byte(oper.Password), []byte(password))
+
+		return func() {
+			delete(s.operChecks, cli)
+
+			if err != nil {
+				s.OperFail(cli, name)
+
+				return
+			}
+
+			s.OperUp(cli, name, oper.Privileges)
+		}
+	})
+}
+
+// Reply 464, disconnecting the client once it failed OperMaxFailures times.
+func (s *Server) OperFail(cli *client.Client, name string) {
+	s.log.Info().Str("name", name).Str("remote", cli.RemoteHost).Msg("bad operator password")
+
+	err := cli.ReplyNicknamed("464", "Password incorrect")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.operFailures[cli]++
+	if s.operFailures[cli] >= OperMaxFailures {
+		s.Disconnect(cli, "Too many failed OPER attempts")
+	}
+}
+
+// Grant operator status with the privileges of the operator block.
+func (s *Server) OperUp(cli *client.Client, name string, privileges []string) {
+	cli.SetOperator(true, privileges)
+
+	s.log.Info().Str("name", name).Str("nickname", cli.Nickname()).Msg("operator up")
+
+	err := cli.ReplyNicknamed("381", "You are now an IRC operator")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	err = cli.Respond(message.New(cli.Nickname(), "MODE", cli.Nickname(), "+o").String())
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Check whether cli matches host mask and certificate fingerprint of the
+// operator block, both being optional.
+func (s *Server) OperHostAllowed(cli *client.Client, oper *config.Operator) bool {
+	if oper.Host != "" && !mask.Match(mask.Normalize(oper.Host), cli.String()) {
+		return false
+	}
+
+	if oper.Fingerprint == "" {
+		return true
+	}
+
+	cert := cli.Certificate()
+
+	return cert != nil && oper.FingerprintMatches(config.Fingerprint(cert))
+}
+
+// Check whether cli holds the privilege, replying 481 otherwise.
+func (s *Server) Privileged(cli *client.Client, privilege string) bool {
+	if cli.Privileged(privilege) {
+		return true
+	}
+
+	err := cli.ReplyNicknamed("481", "Permission Denied- You're not an IRC operator")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	return false
+}
+
+// KILL nickname :reason.
+func (s *Server) HandlerKill(cli *client.Client, params []string) {
+	if !s.Privileged(cli, config.PrivilegeKill) {
+		return
+	}
+
+	if len(params) == 0 {
+		err := cli.ReplyNotEnoughParameters("KILL")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	nickname, reason := params[0], strings.Join(params[1:], " ")
+	if reason == "" {
+		reason = cli.Nickname()
+	}
+
+	target := s.Client(nickname)
+	if target == nil {
+		err := cli.ReplyNoNickChan(nickname)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	s.log.Info().Str("operator", cli.Nickname()).Str("nickname", target.Nickname()).Str("reason", reason).Msg("killed")
+
+	reason = fmt.Sprintf("Killed (%s (%s))", cli.Nickname(), reason)
+
+	err := target.Msg(message.New(cli.String(), "KILL", target.Nickname(), reason).String())
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.Disconnect(target, reason)
+}
+
+// Close connection of the client with ERROR telling the reason.
+func (s *Server) Disconnect(cli *client.Client, reason string) {
+	err := cli.Msg(message.New("", "ERROR", fmt.Sprintf("Closing Link: %s (%s)", cli.Host(), reason)).String())
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.ClientGone(cli, reason)
+
+	err = cli.Stop(context.Background())
+	if err != nil {
+		s.log.Err(err).Msg("cannot stop client")
+	}
+}
+
+// Send server NOTICE to the client.
+func (s *Server) Notice(cli *client.Client, text string) {
+	err := cli.ReplyParts("NOTICE", cli.Nickname(), "*** "+text)
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// WALLOPS :text, sent to everybody with user mode +w.
+func (s *Server) HandlerWallops(cli *client.Client, params []string) {
+	if !s.Privileged(cli, config.PrivilegeWallops) {
+		return
+	}
+
+	if len(params) == 0 || params[0] == "" {
+		err := cli.ReplyNotEnoughParameters("WALLOPS")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	msg := message.New(cli.String(), "WALLOPS", params[0]).String()
+
+	for c := range s.clients {
+		if !c.Registered || !c.Wallops {
+			continue
+		}
+
+		err := c.Msg(msg)
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
+
+// REHASH re-reads configuration sections without command line flags, such
+// as operator blocks, and the account store.
+func (s *Server) HandlerRehash(cli *client.Client) {
+	if !s.Privileged(cli, config.PrivilegeRehash) {
+		return
+	}
+
+	err := cli.ReplyNicknamed("382", s.configFile, "Rehashing")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	err = s.Rehash()
+	if err != nil {
+		s.log.Err(err).Msg("rehash failed")
+
+		s.Notice(cli, "Rehash failed: "+err.Error())
+
+		return
+	}
+
+	s.log.Info().Str("operator", cli.Nickname()).Msg("rehashed")
+}
+
+// Re-read the configuration file and the account store. Configuration is
+// replaced as a whole, clients and rooms keep reading the one they started
+// with.
+func (s *Server) Rehash() error {
+	if s.configFile != "" {
+		data, err := os.ReadFile(s.configFile)
+		if err != nil {
+			return err
+		}
+
+		cfg := *s.Config()
+
+		err = cfg.LoadSections(data)
+		if err != nil {
+			return err
+		}
+
+		s.config.Store(&cfg)
+		s.limits.configure(cfg.Connections)
+	}
+
+	if store, reloadable := s.accounts.(Reloadable); reloadable {
+		return store.Reload()
+	}
+
+	return nil
+}
+
+// DIE shuts the server down.
+func (s *Server) HandlerDie(cli *client.Client) {
+	if !s.Privileged(cli, config.PrivilegeDie) {
+		return
+	}
+
+	s.log.Info().Str("operator", cli.Nickname()).Msg("shutdown requested")
+
+	// Main loop is the one handling this very command, it picks the stop
+	// request as soon as it is done
+	go func() { s.stop <- true }()
+}
@@ -0,0 +1,78 @@
+package ircd
+
+import (
+	"strings"
+	"testing"
+
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Server with operator block "admin", password "secret".
+func newOperTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.DefaultCost)
+	require.NoError(t, err)
+
+	return newTestServer(t, func(cfg *config.Bootstrap) {
+		cfg.Operators = []config.Operator{{
+			Name:       "admin",
+			Password:   string(hash),
+			Privileges: []string{config.PrivilegeKill},
+		}}
+		// OPER costs a lot, tests send it often
+		cfg.Classes = []config.Class{{Name: "test", Flood: config.Flood{Burst: 50}}}
+	})
+}
+
+func TestOperOneCheckAtATime(t *testing.T) {
+	s := newOperTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("OPER admin wrong")
+	alice.send("OPER admin wrong")
+	alice.expect(" 464 ")
+
+	// The second OPER came while the first was checked
+	alice.send("PING done")
+
+	for _, line := range alice.readUntil("PONG") {
+		require.NotContains(t, line, " 464 ")
+	}
+
+	alice.send("OPER admin secret")
+	alice.expect(" 381 ")
+}
+
+func TestKillReason(t *testing.T) {
+	s := newOperTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("OPER admin secret")
+	alice.expect(" 381 ")
+
+	bob := dialTest(t, s, "bob")
+	carol := dialTest(t, s, "carol")
+
+	tests := []struct {
+		name    string
+		target  *testConn
+		command string
+		want    string
+	}{
+		{name: "given", target: bob, command: "KILL bob :spamming", want: "Killed (alice (spamming))"},
+		{name: "default", target: carol, command: "KILL carol", want: "Killed (alice (alice))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice.send(tt.command)
+
+			line := tt.target.expect("ERROR")
+			require.True(t, strings.HasSuffix(line, "("+tt.want+")"), line)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package ircd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoomNamesFoldCase(t *testing.T) {
+	s := newTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("JOIN #Test")
+	alice.expect(" 366 ")
+
+	bob := dialTest(t, s, "bob")
+	bob.send("JOIN #tEST")
+
+	// Same room, shown as its founder spelled it
+	require.Contains(t, bob.expect(" 353 "), "#Test :@alice bob")
+	alice.expect("JOIN #Test")
+
+	bob.send("LUSERS")
+	require.Contains(t, bob.expect(" 254 "), " 1 ")
+}
+
+func TestRoomsSeeClientChanges(t *testing.T) {
+	s := newTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("JOIN #room")
+	alice.expect(" 366 ")
+
+	bob := dialTest(t, s, "bob")
+	bob.send("JOIN #room")
+	bob.expect(" 366 ")
+
+	// Room keeps relaying while bob changes, nothing races
+	for i := 0; i < 5; i++ {
+		alice.send("PRIVMSG #room :hello")
+	}
+
+	bob.send("NICK robert")
+	bob.send("MODE robert +i")
+	bob.send("AWAY :gone")
+	alice.expect("NICK robert")
+
+	alice.send("NAMES #room")
+	require.Contains(t, alice.expect(" 353 "), "robert")
+
+	alice.send("WHO #room")
+	require.Contains(t, alice.expect("robert"), " G ")
+}
+
+func TestInviteNotify(t *testing.T) {
+	s := newTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("JOIN #room")
+	alice.expect(" 366 ")
+
+	carol := dialTest(t, s, "carol")
+	carol.send("CAP REQ invite-notify")
+	carol.expect("ACK")
+	carol.send("JOIN #room")
+	carol.expect(" 366 ")
+
+	dave := dialTest(t, s, "dave")
+	dave.send("JOIN #room")
+	dave.expect(" 366 ")
+
+	erin := dialTest(t, s, "erin")
+	erin.send("JOIN #room")
+	erin.expect(" 366 ")
+
+	alice.send("MODE #room +o dave")
+	dave.expect("MODE #room +o dave")
+
+	dialTest(t, s, "bob")
+	alice.send("INVITE bob #room")
+	alice.expect(" 341 ")
+
+	require.Contains(t, carol.expect("bob"), " INVITE bob #room")
+	require.Contains(t, dave.expect("bob"), " NOTICE #room :alice invited bob into the channel")
+
+	// Plain members hear nothing
+	erin.send("PING done")
+	for _, line := range erin.readUntil("PONG") {
+		require.NotContains(t, line, "bob")
+	}
+}
+
+func TestRoomModeChanges(t *testing.T) {
+	s := newTestServer(t)
+
+	alice := dialTest(t, s, "alice")
+	alice.send("JOIN #room")
+	alice.expect(" 366 ")
+
+	alice.send("MODE #room +l zero")
+	require.Contains(t, alice.expect(" 696 "), "#room l zero :Invalid limit")
+
+	alice.send("MODE #room +l 0")
+	require.Contains(t, alice.expect(" 696 "), "#room l 0 :Invalid limit")
+
+	// Masks beyond MODES are ignored
+	alice.send("MODE #room +bbbbb a!*@* b!*@* c!*@* d!*@* e!*@*")
+	require.Contains(t, alice.expect("MODE #room"), "+bbbb a!*@* b!*@* c!*@* d!*@*")
+
+	alice.send("MODE #room b")
+	lines := alice.readUntil(" 368 ")
+	require.Len(t, lines, 5)
+}
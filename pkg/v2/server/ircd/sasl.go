@@ -0,0 +1,283 @@
+package ircd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	CapSASL = "sasl"
+
+	SASLChunkSize   = 400  // AUTHENTICATE payload is sent in chunks of this size
+	SASLMaxLength   = 8192 // Max length of the whole encoded payload
+	SASLMaxFailures = 3    // Failed attempts before the client is disconnected
+)
+
+// SASL exchange in progress for a client.
+type saslSession struct {
+	buffer    strings.Builder
+	mechanism string
+	verifying bool // Credentials are being checked off the main loop
+}
+
+// Mechanisms clients can authenticate with, as advertised in the sasl
+// capability value and 908 reply.
+func (s *Server) SASLMechanisms() []string {
+	mechanisms := []string{}
+
+	// Client certificates are always verified on TLS listener
+	if s.isTLS {
+		mechanisms = append(mechanisms, "EXTERNAL")
+	}
+
+	if s.accounts != nil {
+		mechanisms = append(mechanisms, "PLAIN")
+	}
+
+	return mechanisms
+}
+
+// Handle AUTHENTICATE exchange: mechanism selection, base64 payload sent
+// in chunks of SASLChunkSize and "*" to abort.
+func (s *Server) HandlerAuthenticate(cli *client.Client, params []string) {
+	if len(params) == 0 || params[0] == "" {
+		err := cli.ReplyNotEnoughParameters("AUTHENTICATE")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	if !cli.Caps.Has(CapSASL) {
+		s.SASLFail(cli)
+
+		return
+	}
+
+	if cli.Account != "" {
+		err := cli.ReplyNicknamed("907", "You have already authenticated using SASL")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	arg := params[0]
+
+	if arg == "*" {
+		delete(s.sasl, cli)
+
+		err := cli.ReplyNicknamed("906", "SASL authentication aborted")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	session, found := s.sasl[cli]
+	if !found {
+		mechanism := strings.ToUpper(arg)
+		mechanisms := s.SASLMechanisms()
+
+		supported := false
+
+		for _, m := range mechanisms {
+			if m == mechanism {
+				supported = true
+			}
+		}
+
+		if !supported {
+			err := cli.ReplyNicknamed("908", strings.Join(mechanisms, ","), "are available SASL mechanisms")
+			if err != nil {
+				s.log.Err(err).Msg("cannot send message")
+			}
+
+			s.SASLFail(cli)
+
+			return
+		}
+
+		s.sasl[cli] = &saslSession{mechanism: mechanism}
+
+		err := cli.Respond("AUTHENTICATE +")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	// Client must wait for the outcome of the credentials it sent
+	if session.verifying {
+		return
+	}
+
+	if arg != "+" {
+		session.buffer.WriteString(arg)
+	}
+
+	if session.buffer.Len() > SASLMaxLength {
+		delete(s.sasl, cli)
+
+		err := cli.ReplyNicknamed("905", "SASL message too long")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	// Full sized chunk means more is coming
+	if len(arg) == SASLChunkSize {
+		return
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(session.buffer.String())
+	if err != nil {
+		delete(s.sasl, cli)
+		s.SASLFail(cli)
+
+		return
+	}
+
+	switch session.mechanism {
+	case "EXTERNAL":
+		delete(s.sasl, cli)
+		s.SASLExternal(cli, payload)
+	case "PLAIN":
+		s.SASLPlain(cli, session, payload)
+	default:
+		delete(s.sasl, cli)
+		s.SASLFail(cli)
+	}
+}
+
+// Check "authzid\0authcid\0password" payload against the account store.
+// Logging in as somebody else than the authenticated account is refused.
+// Password is checked off the main loop, the session is kept until then.
+func (s *Server) SASLPlain(cli *client.Client, session *saslSession, payload []byte) {
+	parts := bytes.Split(payload, []byte{0})
+	authzid, authcid := "", ""
+
+	if len(parts) == 3 {
+		authzid, authcid = string(parts[0]), string(parts[1])
+	}
+
+	if len(parts) != 3 || (authzid != "" && !strings.EqualFold(authzid, authcid)) {
+		delete(s.sasl, cli)
+		s.SASLFail(cli)
+
+		return
+	}
+
+	password := string(parts[2])
+	session.verifying = true
+
+	s.Offload(cli, func() func() {
+		name, err := s.accounts.Authenticate(authcid, password)
+
+		return func() {
+			// Aborted meanwhile
+			if s.sasl[cli] != session {
+				return
+			}
+
+			delete(s.sasl, cli)
+
+			if err != nil {
+				s.log.Info().Str("account", authcid).Msg("SASL authentication failed")
+				s.SASLFail(cli)
+
+				return
+			}
+
+			s.LoginAccount(cli, name)
+			s.SASLSuccess(cli)
+		}
+	})
+}
+
+// Log in to the account the verified TLS client certificate maps to. The
+// optional payload is the requested account, which must be that one.
+func (s *Server) SASLExternal(cli *client.Client, payload []byte) {
+	cert := cli.Certificate()
+	if cert == nil {
+		s.SASLFail(cli)
+
+		return
+	}
+
+	name, found := s.Config().CertAuth.Account(cert)
+	if !found || (len(payload) > 0 && !strings.EqualFold(string(payload), name)) {
+		s.log.Info().Str("identity", s.Config().CertAuth.Identity(cert)).Msg("SASL EXTERNAL failed")
+		s.SASLFail(cli)
+
+		return
+	}
+
+	s.LoginAccount(cli, name)
+	s.SASLSuccess(cli)
+}
+
+// Check nickname against the client certificate when certAuth.forceNick
+// is set. Clients without certificate are not restricted.
+func (s *Server) CertNickAllowed(cli *client.Client, nickname string) bool {
+	if !s.Config().CertAuth.ForceNick {
+		return true
+	}
+
+	cert := cli.Certificate()
+
+	return cert == nil || strings.EqualFold(cert.Subject.CommonName, nickname)
+}
+
+// Mark cli as logged in to the account and tell it. A registered client
+// also learns about its new user mode +r.
+func (s *Server) LoginAccount(cli *client.Client, name string) {
+	cli.Account = name
+
+	s.log.Info().Str("account", name).Str("remote", cli.RemoteHost).Msg("logged in")
+
+	err := cli.ReplyNicknamed("900", cli.String(), name, "You are now logged in as "+name)
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	if !cli.Registered {
+		return
+	}
+
+	err = cli.Respond(message.New(cli.Nickname(), "MODE", cli.Nickname(), "+"+string(client.UserModeRegistered)).String())
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+func (s *Server) SASLSuccess(cli *client.Client) {
+	err := cli.ReplyNicknamed("903", "SASL authentication successful")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Reply 904, disconnecting the client once it failed SASLMaxFailures times.
+func (s *Server) SASLFail(cli *client.Client) {
+	err := cli.ReplyNicknamed("904", "SASL authentication failed")
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+
+	s.saslFailures[cli]++
+	if s.saslFailures[cli] >= SASLMaxFailures {
+		s.log.Info().Str("remote", cli.RemoteHost).Msg("too many SASL failures")
+		s.Disconnect(cli, "Too many SASL failures")
+	}
+}
@@ -0,0 +1,36 @@
+package ircd
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/account"
+	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+)
+
+// Accounts by name with their plain passwords.
+type testAccounts map[string]string
+
+func (a testAccounts) Authenticate(name, password string) (string, error) {
+	if p, found := a[name]; !found || p != password {
+		return "", account.ErrBadCredentials
+	}
+
+	return name, nil
+}
+
+func TestLoginAfterRegistration(t *testing.T) {
+	s := startTestServer(t, Accounts(testAccounts{"alice": "secret"}), Config(&config.Bootstrap{Bind: "127.0.0.1:0"}))
+
+	alice := dialTest(t, s, "alice")
+	alice.send("CAP REQ :sasl")
+	alice.expect("ACK")
+
+	alice.send("AUTHENTICATE PLAIN")
+	alice.expect("AUTHENTICATE +")
+
+	alice.send("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("\x00alice\x00secret")))
+	alice.expect(" 900 ")
+	alice.expect("MODE alice +r")
+	alice.expect(" 903 ")
+}
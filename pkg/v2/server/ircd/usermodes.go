@@ -0,0 +1,97 @@
+package ircd
+
+import (
+	"strings"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+// Query or change user modes of cli itself. Users may set and unset +i and
+// +w and drop +o, the rest is up to the server.
+func (s *Server) HandlerUserMode(cli *client.Client, change string) {
+	if change == "" {
+		err := cli.ReplyNicknamed("221", cli.UserModes())
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	fields := strings.Fields(change)
+	if len(fields) == 0 {
+		err := cli.ReplyNicknamed("501", "Unknown MODE flag")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+
+		return
+	}
+
+	adding := true
+	applied := ""
+	sign := byte(0)
+	unknown := false
+
+	for _, c := range fields[0] {
+		switch c {
+		case '+':
+			adding = true
+			continue
+		case '-':
+			adding = false
+			continue
+		case client.UserModeInvisible:
+			if cli.Invisible() == adding {
+				continue
+			}
+
+			cli.SetInvisible(adding)
+		case client.UserModeWallops:
+			if cli.Wallops == adding {
+				continue
+			}
+
+			cli.Wallops = adding
+		case client.UserModeOperator:
+			if adding || !cli.Operator {
+				continue
+			}
+
+			cli.SetOperator(false, nil)
+		case client.UserModeRegistered:
+			continue
+		default:
+			unknown = true
+
+			continue
+		}
+
+		if adding && sign != '+' {
+			sign = '+'
+			applied += "+"
+		} else if !adding && sign != '-' {
+			sign = '-'
+			applied += "-"
+		}
+
+		applied += string(c)
+	}
+
+	if unknown {
+		err := cli.ReplyNicknamed("501", "Unknown MODE flag")
+		if err != nil {
+			s.log.Err(err).Msg("cannot send message")
+		}
+	}
+
+	if applied == "" {
+		return
+	}
+
+	err := cli.Respond(message.New(cli.Nickname(), "MODE", cli.Nickname(), applied).String())
+	if err != nil {
+		s.log.Err(err).Msg("cannot send message")
+	}
+}
@@ -0,0 +1,37 @@
+package ircd
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerUserMode(t *testing.T) {
+	logger := zerolog.Nop()
+	s := &Server{log: &logger}
+
+	tests := []struct {
+		name   string
+		change string
+		reply  string
+	}{
+		{name: "query", change: "", reply: ":irc.test 221 * +\r\n"},
+		{name: "only whitespace", change: "   ", reply: ":irc.test 501 * :Unknown MODE flag\r\n"},
+		{name: "unknown flag", change: "+z", reply: ":irc.test 501 * :Unknown MODE flag\r\n"},
+		{name: "set invisible", change: "+i", reply: ":* MODE * +i\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli, out := newTestClient(t)
+
+			s.HandlerUserMode(cli, tt.change)
+
+			line, err := out.ReadString('\n')
+			require.NoError(t, err)
+			require.Equal(t, tt.reply, line)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mask
+
+import "strings"
+
+// Complete a partial nick!user@host mask, so "alice" becomes "alice!*@*"
+// and "*@example.com" becomes "*!*@example.com".
+func Normalize(mask string) string {
+	hasBang := strings.Contains(mask, "!")
+	hasAt := strings.Contains(mask, "@")
+
+	switch {
+	case !hasBang && !hasAt:
+		return mask + "!*@*"
+	case !hasBang:
+		return "*!" + mask
+	case !hasAt:
+		return mask + "@*"
+	default:
+		return mask
+	}
+}
+
+// Match text against a glob mask, where "*" stands for any sequence of
+// characters and "?" for exactly one. Comparison is case insensitive.
+func Match(mask, text string) bool {
+	mask = strings.ToLower(mask)
+	text = strings.ToLower(text)
+
+	// Iterative matching with single backtracking point for the last "*"
+	m, t := 0, 0
+	star, mark := -1, 0
+
+	for t < len(text) {
+		switch {
+		case m < len(mask) && (mask[m] == '?' || mask[m] == text[t]):
+			m++
+			t++
+		case m < len(mask) && mask[m] == '*':
+			star = m
+			mark = t
+			m++
+		case star != -1:
+			m = star + 1
+			mark++
+			t = mark
+		default:
+			return false
+		}
+	}
+
+	for m < len(mask) && mask[m] == '*' {
+		m++
+	}
+
+	return m == len(mask)
+}
@@ -0,0 +1,57 @@
+package mask
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{mask: "alice", want: "alice!*@*"},
+		{mask: "*", want: "*!*@*"},
+		{mask: "*@example.com", want: "*!*@example.com"},
+		{mask: "alice!user", want: "alice!user@*"},
+		{mask: "alice!user@example.com", want: "alice!user@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mask, func(t *testing.T) {
+			require.Equal(t, tt.want, Normalize(tt.mask))
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		mask string
+		text string
+		want bool
+	}{
+		{name: "literal", mask: "alice!a@host", text: "alice!a@host", want: true},
+		{name: "case insensitive", mask: "Alice!A@HOST", text: "alice!a@host", want: true},
+		{name: "star matches everything", mask: "*", text: "alice!a@host", want: true},
+		{name: "star matches nothing", mask: "alice*", text: "alice", want: true},
+		{name: "star in the middle", mask: "alice!*@host", text: "alice!anything@host", want: true},
+		{name: "several stars", mask: "*!*@*.example.com", text: "bob!b@irc.example.com", want: true},
+		{name: "star backtracks", mask: "*a*b", text: "xaxaxb", want: true},
+		{name: "question mark is one character", mask: "al?ce", text: "alice", want: true},
+		{name: "question mark needs a character", mask: "alice?", text: "alice", want: false},
+		{name: "question mark is not two", mask: "a?e", text: "alice", want: false},
+		{name: "anchored at the start", mask: "lice", text: "alice", want: false},
+		{name: "anchored at the end", mask: "alic", text: "alice", want: false},
+		{name: "star does not unanchor the end", mask: "*@host", text: "alice!a@host.example", want: false},
+		{name: "empty mask", mask: "", text: "alice", want: false},
+		{name: "empty text", mask: "*", text: "", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Match(tt.mask, tt.text))
+		})
+	}
+}
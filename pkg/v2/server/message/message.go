@@ -0,0 +1,104 @@
+package message
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrNoCommand = errors.New("message has no command")
+
+// IRC message: optional tags and source, the command (verb) and its
+// parameters. The trailing parameter is just the last one of Params.
+type Message struct {
+	Tags    Tags
+	Source  string
+	Command string
+	Params  []string
+}
+
+// Message without tags, source may be empty.
+func New(source, command string, params ...string) Message {
+	return Message{Source: source, Command: command, Params: params}
+}
+
+// Parse a single line, with or without CRLF, into a message. Runs of
+// spaces between parts are allowed, a trailing parameter keeps its spaces.
+func Parse(line string) (Message, error) {
+	msg := Message{Tags: Tags{}}
+
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		var raw string
+
+		raw, line, _ = strings.Cut(line[1:], " ")
+		msg.Tags = ParseTags(raw)
+		line = strings.TrimLeft(line, " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		msg.Source, line, _ = strings.Cut(line[1:], " ")
+		line = strings.TrimLeft(line, " ")
+	}
+
+	msg.Command, line, _ = strings.Cut(line, " ")
+	if msg.Command == "" {
+		return msg, ErrNoCommand
+	}
+
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			break
+		}
+
+		if line[0] == ':' {
+			msg.Params = append(msg.Params, line[1:])
+
+			break
+		}
+
+		var param string
+
+		param, line, _ = strings.Cut(line, " ")
+		msg.Params = append(msg.Params, param)
+	}
+
+	return msg, nil
+}
+
+// Parameter at the index, empty string if there are not that many.
+func (m Message) Param(i int) string {
+	if i >= len(m.Params) {
+		return ""
+	}
+
+	return m.Params[i]
+}
+
+// Serialize the message without CRLF. The last parameter is sent as
+// trailing one when it has to, i.e. it is empty, has spaces or starts
+// with ":".
+func (m Message) String() string {
+	var b strings.Builder
+
+	b.WriteString(m.Tags.String())
+
+	if m.Source != "" {
+		b.WriteString(":" + m.Source + " ")
+	}
+
+	b.WriteString(m.Command)
+
+	for i, param := range m.Params {
+		b.WriteByte(' ')
+
+		if i == len(m.Params)-1 && (param == "" || strings.Contains(param, " ") || param[0] == ':') {
+			b.WriteByte(':')
+		}
+
+		b.WriteString(param)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Vectors of msg-split.yaml from the IRCv3 parser-tests suite.
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line   string
+		tags   Tags
+		source string
+		verb   string
+		params []string
+	}{
+		// Simple
+		{line: "foo bar baz asdf", verb: "foo", params: []string{"bar", "baz", "asdf"}},
+		// With source
+		{line: ":coolguy foo bar baz asdf", source: "coolguy", verb: "foo", params: []string{"bar", "baz", "asdf"}},
+		// With trailing param
+		{line: "foo bar baz :asdf quux", verb: "foo", params: []string{"bar", "baz", "asdf quux"}},
+		{line: "foo bar baz :", verb: "foo", params: []string{"bar", "baz", ""}},
+		{line: "foo bar baz ::asdf", verb: "foo", params: []string{"bar", "baz", ":asdf"}},
+		// With source and trailing param
+		{line: ":coolguy foo bar baz :asdf quux", source: "coolguy", verb: "foo", params: []string{"bar", "baz", "asdf quux"}},
+		{line: ":coolguy foo bar baz :  asdf quux ", source: "coolguy", verb: "foo", params: []string{"bar", "baz", "  asdf quux "}},
+		{line: ":coolguy PRIVMSG bar :lol :) ", source: "coolguy", verb: "PRIVMSG", params: []string{"bar", "lol :) "}},
+		{line: ":coolguy foo bar baz :", source: "coolguy", verb: "foo", params: []string{"bar", "baz", ""}},
+		{line: ":coolguy foo bar baz :  ", source: "coolguy", verb: "foo", params: []string{"bar", "baz", "  "}},
+		// With tags
+		{line: "@a=b;c=32;k;rt=ql7 foo", tags: Tags{"a": "b", "c": "32", "k": "", "rt": "ql7"}, verb: "foo"},
+		// With escaped tags
+		{line: "@a=b\\\\and\\nk;c=72\\s45;d=gh\\:764 foo", tags: Tags{"a": "b\\and\nk", "c": "72 45", "d": "gh;764"}, verb: "foo"},
+		// With tags and source
+		{line: "@c;h=;a=b :quux ab cd", tags: Tags{"c": "", "h": "", "a": "b"}, source: "quux", verb: "ab", params: []string{"cd"}},
+		// Different forms of last param
+		{line: ":src JOIN #chan", source: "src", verb: "JOIN", params: []string{"#chan"}},
+		{line: ":src JOIN :#chan", source: "src", verb: "JOIN", params: []string{"#chan"}},
+		// With and without last param
+		{line: ":src AWAY", source: "src", verb: "AWAY"},
+		{line: ":src AWAY ", source: "src", verb: "AWAY"},
+		// Tab is not considered whitespace
+		{line: ":cool\tguy foo bar baz", source: "cool\tguy", verb: "foo", params: []string{"bar", "baz"}},
+		// With weird control codes in the source
+		{line: ":coolguy!ag@net\x035w\x03ork.admin PRIVMSG foo :bar baz", source: "coolguy!ag@net\x035w\x03ork.admin", verb: "PRIVMSG", params: []string{"foo", "bar baz"}},
+		{line: ":coolguy!~ag@n\x02et\x0305w\x0fork.admin PRIVMSG foo :bar baz", source: "coolguy!~ag@n\x02et\x0305w\x0fork.admin", verb: "PRIVMSG", params: []string{"foo", "bar baz"}},
+		{
+			line:   "@tag1=value1;tag2;vendor1/tag3=value2;vendor2/tag4= :irc.example.com COMMAND param1 param2 :param3 param3",
+			tags:   Tags{"tag1": "value1", "tag2": "", "vendor1/tag3": "value2", "vendor2/tag4": ""},
+			source: "irc.example.com",
+			verb:   "COMMAND",
+			params: []string{"param1", "param2", "param3 param3"},
+		},
+		{line: ":irc.example.com COMMAND param1 param2 :param3 param3", source: "irc.example.com", verb: "COMMAND", params: []string{"param1", "param2", "param3 param3"}},
+		{
+			line:   "@tag1=value1;tag2;vendor1/tag3=value2;vendor2/tag4 COMMAND param1 param2 :param3 param3",
+			tags:   Tags{"tag1": "value1", "tag2": "", "vendor1/tag3": "value2", "vendor2/tag4": ""},
+			verb:   "COMMAND",
+			params: []string{"param1", "param2", "param3 param3"},
+		},
+		{line: "COMMAND", verb: "COMMAND"},
+		// Yaml encoding + slashes is fun
+		{line: "@foo=\\\\\\\\\\:\\\\s\\s\\r\\n COMMAND", tags: Tags{"foo": "\\\\;\\s \r\n"}, verb: "COMMAND"},
+		// Broken messages from unreal
+		{line: ":gravel.mozilla.org 432  #momo :Erroneous Nickname: Illegal characters", source: "gravel.mozilla.org", verb: "432", params: []string{"#momo", "Erroneous Nickname: Illegal characters"}},
+		{line: ":gravel.mozilla.org MODE #tckk +n ", source: "gravel.mozilla.org", verb: "MODE", params: []string{"#tckk", "+n"}},
+		{line: ":services.esper.net MODE #foo-bar +o foobar  ", source: "services.esper.net", verb: "MODE", params: []string{"#foo-bar", "+o", "foobar"}},
+		// Tag values should be parsed char-at-a-time to prevent wayward replacements
+		{line: "@tag1=value\\\\ntest COMMAND", tags: Tags{"tag1": "value\\ntest"}, verb: "COMMAND"},
+		// If a tag value has a slash followed by a character which doesn't
+		// need to be escaped, the slash should be dropped
+		{line: "@tag1=value\\1 COMMAND", tags: Tags{"tag1": "value1"}, verb: "COMMAND"},
+		// A slash at the end of a tag value should be dropped
+		{line: "@tag1=value1\\ COMMAND", tags: Tags{"tag1": "value1"}, verb: "COMMAND"},
+		// Duplicate tags: last value wins
+		{line: "@tag1=1;tag2=3;tag3=4;tag1=5 COMMAND", tags: Tags{"tag1": "5", "tag2": "3", "tag3": "4"}, verb: "COMMAND"},
+		// Vendored tags can have the same name as a non-vendored tag
+		{line: "@tag1=1;tag2=3;tag3=4;tag1=5;vendor/tag2=8 COMMAND", tags: Tags{"tag1": "5", "tag2": "3", "tag3": "4", "vendor/tag2": "8"}, verb: "COMMAND"},
+		// Some parsers handle /MODE in a special way, make sure they do it right
+		{line: ":SomeOp MODE #channel :+i", source: "SomeOp", verb: "MODE", params: []string{"#channel", "+i"}},
+		{line: ":SomeOp MODE #channel +oo SomeUser :AnotherUser", source: "SomeOp", verb: "MODE", params: []string{"#channel", "+oo", "SomeUser", "AnotherUser"}},
+		// Line endings are not part of the message
+		{line: "PRIVMSG #chan :hello\r\n", verb: "PRIVMSG", params: []string{"#chan", "hello"}},
+		{line: "PING x\n", verb: "PING", params: []string{"x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			msg, err := Parse(tt.line)
+			require.NoError(t, err)
+
+			tags := tt.tags
+			if tags == nil {
+				tags = Tags{}
+			}
+
+			require.Equal(t, tags, msg.Tags)
+			require.Equal(t, tt.source, msg.Source)
+			require.Equal(t, tt.verb, msg.Command)
+			require.Equal(t, tt.params, msg.Params)
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, line := range []string{"", " ", "\r\n", "@a=b", "@a=b ", ":src", ":src  ", "@a=b :src "} {
+		t.Run(line, func(t *testing.T) {
+			_, err := Parse(line)
+			require.ErrorIs(t, err, ErrNoCommand)
+		})
+	}
+}
+
+// Vectors of msg-join.yaml from the IRCv3 parser-tests suite. Tags are
+// serialized sorted, so there is a single valid output for each.
+func TestString(t *testing.T) {
+	tests := []struct {
+		msg  Message
+		line string
+	}{
+		// Simple test with verb and params
+		{Message{Command: "foo", Params: []string{"bar", "baz", "asdf"}}, "foo bar baz asdf"},
+		// Simple test with source and no params
+		{Message{Source: "src", Command: "AWAY"}, ":src AWAY"},
+		// Simple test with source and empty trailing param
+		{Message{Source: "src", Command: "AWAY", Params: []string{""}}, ":src AWAY :"},
+		// Simple test with source
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", "asdf"}}, ":coolguy foo bar baz asdf"},
+		// Simple test with trailing param
+		{Message{Command: "foo", Params: []string{"bar", "baz", "asdf quux"}}, "foo bar baz :asdf quux"},
+		// Simple test with empty trailing param
+		{Message{Command: "foo", Params: []string{"bar", "baz", ""}}, "foo bar baz :"},
+		// Simple test with trailing param containing colon
+		{Message{Command: "foo", Params: []string{"bar", "baz", ":asdf"}}, "foo bar baz ::asdf"},
+		// Test with source and trailing param
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", "asdf quux"}}, ":coolguy foo bar baz :asdf quux"},
+		// Test with trailing containing beginning+end whitespace
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", "  asdf quux "}}, ":coolguy foo bar baz :  asdf quux "},
+		// Test with trailing containing what looks like another trailing param
+		{Message{Source: "coolguy", Command: "PRIVMSG", Params: []string{"bar", "lol :) "}}, ":coolguy PRIVMSG bar :lol :) "},
+		// Simple test with source and empty trailing
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", ""}}, ":coolguy foo bar baz :"},
+		// Trailing contains only spaces
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", "  "}}, ":coolguy foo bar baz :  "},
+		// Param containing tab (tab is not considered SPACE for message splitting)
+		{Message{Source: "coolguy", Command: "foo", Params: []string{"b\tar", "baz"}}, ":coolguy foo b\tar baz"},
+		// Tags with no value and space-filled trailing
+		{Message{Tags: Tags{"asd": ""}, Source: "coolguy", Command: "foo", Params: []string{"bar", "baz", "  "}}, "@asd :coolguy foo bar baz :  "},
+		// Tags with escaped values
+		{Message{Tags: Tags{"a": "b\\and\nk", "d": "gh;764"}, Command: "foo"}, "@a=b\\\\and\\nk;d=gh\\:764 foo"},
+		// Tags with escaped values and params
+		{Message{Tags: Tags{"a": "b\\and\nk", "d": "gh;764"}, Command: "foo", Params: []string{"par1", "par2"}}, "@a=b\\\\and\\nk;d=gh\\:764 foo par1 par2"},
+		{Message{Tags: Tags{"a": "b\\and\nk", "d": "gh;764"}, Command: "foo", Params: []string{"par1", ":par2"}}, "@a=b\\\\and\\nk;d=gh\\:764 foo par1 ::par2"},
+		// Tag with long, strange values (including LF and newline)
+		{Message{Tags: Tags{"foo": "\\\\;\\s \r\n"}, Command: "COMMAND"}, "@foo=\\\\\\\\\\:\\\\s\\s\\r\\n COMMAND"},
+		// Built with New
+		{New("irc.example.com", "PRIVMSG", "#chan", "hi there"), ":irc.example.com PRIVMSG #chan :hi there"},
+		{New("", "PING", "irc.example.com"), "PING irc.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			require.Equal(t, tt.line, tt.msg.String())
+		})
+	}
+}
+
+// Serializing a parsed message and parsing it again gives the same message.
+func TestRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"@+draft/reply=abc;time=2023-01-01T00:00:00.000Z :nick!user@host PRIVMSG #chan :hello there",
+		":server 353 nick = #chan :@alice +bob carol",
+		"CAP REQ :sasl message-tags",
+		"PING :",
+		"MODE #chan +kl key 10",
+	} {
+		t.Run(line, func(t *testing.T) {
+			msg, err := Parse(line)
+			require.NoError(t, err)
+
+			again, err := Parse(msg.String())
+			require.NoError(t, err)
+			require.Equal(t, msg, again)
+		})
+	}
+}
+
+func TestParam(t *testing.T) {
+	msg := Message{Command: "KICK", Params: []string{"#chan", "bob"}}
+
+	require.Equal(t, "#chan", msg.Param(0))
+	require.Equal(t, "bob", msg.Param(1))
+	require.Equal(t, "", msg.Param(2))
+}
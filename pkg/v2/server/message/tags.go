@@ -0,0 +1,144 @@
+package message
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TagBatch = "batch"
+	TagLabel = "label"
+	TagMsgID = "msgid"
+	TagTime  = "time"
+
+	TimeFormat = "2006-01-02T15:04:05.000Z" // RFC 3339 with milliseconds, UTC
+)
+
+// IRCv3 message tags, keyed by tag name. Tags without value map to "".
+type Tags map[string]string
+
+var (
+	tagEscaper   = strings.NewReplacer("\\", "\\\\", ";", "\\:", " ", "\\s", "\r", "\\r", "\n", "\\n")
+	tagUnescapes = map[byte]string{':': ";", 's': " ", '\\': "\\", 'r': "\r", 'n': "\n"}
+)
+
+// Parse "a=b;c" tags, without the leading "@". Later duplicates win.
+func ParseTags(raw string) Tags {
+	tags := Tags{}
+
+	for _, tag := range strings.Split(raw, ";") {
+		if tag == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(tag, "=")
+		tags[key] = UnescapeTagValue(value)
+	}
+
+	return tags
+}
+
+// Undo tag value escaping. Unknown escapes lose their backslash, lone
+// trailing backslash is dropped.
+func UnescapeTagValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if i == len(value) {
+			break
+		}
+
+		if unescaped, found := tagUnescapes[value[i]]; found {
+			b.WriteString(unescaped)
+		} else {
+			b.WriteByte(value[i])
+		}
+	}
+
+	return b.String()
+}
+
+func EscapeTagValue(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+// Copy of tags with the tag set.
+func (t Tags) With(key, value string) Tags {
+	tags := make(Tags, len(t)+1)
+	for k, v := range t {
+		tags[k] = v
+	}
+
+	tags[key] = value
+
+	return tags
+}
+
+// Tags with time set to the given moment.
+func (t Tags) WithTime(at time.Time) Tags {
+	return t.With(TagTime, at.UTC().Format(TimeFormat))
+}
+
+// Tags with a new unique message ID set.
+func (t Tags) WithMsgID() Tags {
+	return t.With(TagMsgID, uuid.NewString())
+}
+
+// Tags with the batch reference set, unless it is empty.
+func (t Tags) WithBatch(ref string) Tags {
+	if ref == "" {
+		return t
+	}
+
+	return t.With(TagBatch, ref)
+}
+
+// Only client-only tags, i.e. those prefixed with "+", which are relayed
+// to recipients as they are.
+func (t Tags) ClientOnly() Tags {
+	tags := Tags{}
+
+	for k, v := range t {
+		if strings.HasPrefix(k, "+") {
+			tags[k] = v
+		}
+	}
+
+	return tags
+}
+
+// Serialize tags as line prefix, "@a=b;c " or empty string without tags.
+// Tags are sorted to get stable output.
+func (t Tags) String() string {
+	if len(t) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		if t[k] != "" {
+			keys[i] = k + "=" + EscapeTagValue(t[k])
+		}
+	}
+
+	return "@" + strings.Join(keys, ";") + " "
+}
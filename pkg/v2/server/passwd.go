@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func CmdPasswd() *cli.Command {
+	return &cli.Command{
+		Name:  "passwd",
+		Usage: "hash a password read from stdin for the accounts file",
+		Action: func(cCtx *cli.Context) error {
+			password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && password == "" {
+				return err
+			}
+
+			hash, err := bcrypt.GenerateFromPassword([]byte(strings.TrimRight(password, "\r\n")), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(hash))
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,310 @@
+package room
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+const (
+	CapChatHistory = "draft/chathistory"
+
+	HistoryDefaultSize = 1000 // Messages kept per room unless configured
+	HistoryMaxLimit    = 100  // Max messages returned by a single CHATHISTORY
+)
+
+var (
+	ErrBadSelector = errors.New("invalid message selector")
+)
+
+func init() {
+	caps.Register(CapChatHistory, "")
+}
+
+// Message kept in the room history together with the tags it was relayed
+// with, time and msgid among them.
+type HistoryEntry struct {
+	Time    time.Time
+	Tags    message.Tags
+	MsgID   string
+	Line    string
+	TagOnly bool
+}
+
+// Point in the history CHATHISTORY refers to, either "timestamp=...",
+// "msgid=..." or "*" meaning no point at all.
+type Selector struct {
+	Time  time.Time
+	MsgID string
+}
+
+// Bounded history of room messages, oldest first. It is written by the
+// room and read by the server, hence the lock.
+type History struct {
+	mu      sync.RWMutex
+	entries []HistoryEntry
+	size    int
+	maxAge  time.Duration
+}
+
+// Parse CHATHISTORY message selector.
+func ParseSelector(text string) (Selector, error) {
+	if text == "*" {
+		return Selector{}, nil
+	}
+
+	kind, value, found := strings.Cut(text, "=")
+	if !found || value == "" {
+		return Selector{}, ErrBadSelector
+	}
+
+	switch kind {
+	case "timestamp":
+		t, err := time.Parse(message.TimeFormat, value)
+		if err != nil {
+			return Selector{}, ErrBadSelector
+		}
+
+		return Selector{Time: t}, nil
+	case "msgid":
+		return Selector{MsgID: value}, nil
+	}
+
+	return Selector{}, ErrBadSelector
+}
+
+// Check whether the selector is "*".
+func (s Selector) Empty() bool {
+	return s.MsgID == "" && s.Time.IsZero()
+}
+
+func NewHistory(size int, maxAge time.Duration) *History {
+	if size <= 0 {
+		size = HistoryDefaultSize
+	}
+
+	return &History{size: size, maxAge: maxAge}
+}
+
+// Remember a message, forgetting the oldest one when full.
+func (h *History) Add(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > h.size {
+		h.entries = append([]HistoryEntry(nil), h.entries[len(h.entries)-h.size:]...)
+	}
+}
+
+// Entries not older than maxAge.
+func (h *History) live() []HistoryEntry {
+	if h.maxAge == 0 {
+		return h.entries
+	}
+
+	deadline := time.Now().Add(-h.maxAge)
+	i := sort.Search(len(h.entries), func(i int) bool {
+		return h.entries[i].Time.After(deadline)
+	})
+
+	return h.entries[i:]
+}
+
+// Position of the selector in entries: index of the first entry past it if
+// after is set, index of the first entry not before it otherwise.
+func position(entries []HistoryEntry, sel Selector, after bool) (int, bool) {
+	if sel.MsgID != "" {
+		for i, entry := range entries {
+			if entry.MsgID == sel.MsgID {
+				if after {
+					return i + 1, true
+				}
+
+				return i, true
+			}
+		}
+
+		return 0, false
+	}
+
+	return sort.Search(len(entries), func(i int) bool {
+		if after {
+			return entries[i].Time.After(sel.Time)
+		}
+
+		return !entries[i].Time.Before(sel.Time)
+	}), true
+}
+
+// Copy of at most limit entries from the start or the end of the slice.
+func head(entries []HistoryEntry, limit int) []HistoryEntry {
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return append([]HistoryEntry(nil), entries...)
+}
+
+func tail(entries []HistoryEntry, limit int) []HistoryEntry {
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	return append([]HistoryEntry(nil), entries...)
+}
+
+// Latest messages, only those after sel unless it is empty.
+func (h *History) Latest(sel Selector, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+
+	if !sel.Empty() {
+		start, found := position(entries, sel, true)
+		if !found {
+			return nil
+		}
+
+		entries = entries[start:]
+	}
+
+	return tail(entries, limit)
+}
+
+// Messages right before sel.
+func (h *History) Before(sel Selector, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+
+	end, found := position(entries, sel, false)
+	if !found {
+		return nil
+	}
+
+	return tail(entries[:end], limit)
+}
+
+// Messages right after sel.
+func (h *History) After(sel Selector, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+
+	start, found := position(entries, sel, true)
+	if !found {
+		return nil
+	}
+
+	return head(entries[start:], limit)
+}
+
+// Messages surrounding sel, half of them before it.
+func (h *History) Around(sel Selector, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+
+	middle, found := position(entries, sel, false)
+	if !found {
+		return nil
+	}
+
+	start := middle - limit/2
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + limit
+	if end > len(entries) {
+		end = len(entries)
+		start = end - limit
+
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	return head(entries[start:end], limit)
+}
+
+// Messages strictly between the two selectors. When from is later than
+// to, messages closest to from are returned.
+func (h *History) Between(from, to Selector, limit int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+
+	posFrom, foundFrom := position(entries, from, false)
+	posTo, foundTo := position(entries, to, false)
+
+	if !foundFrom || !foundTo {
+		return nil
+	}
+
+	if posFrom <= posTo {
+		start, _ := position(entries, from, true)
+		if start > posTo {
+			return nil
+		}
+
+		return head(entries[start:posTo], limit)
+	}
+
+	start, _ := position(entries, to, true)
+	if start > posFrom {
+		return nil
+	}
+
+	return tail(entries[start:posFrom], limit)
+}
+
+// Time of the latest message, if any.
+func (h *History) LatestTime() (time.Time, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	entries := h.live()
+	if len(entries) == 0 {
+		return time.Time{}, false
+	}
+
+	return entries[len(entries)-1].Time, true
+}
+
+// Send history entries to cli inside a chathistory batch. TAGMSG entries
+// are skipped for clients without message-tags.
+func (r *Room) SendHistory(cli *client.Client, entries []HistoryEntry) {
+	ref, err := cli.StartBatch("chathistory", r.Name)
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+
+	for _, entry := range entries {
+		if entry.TagOnly && !cli.Caps.Has(client.CapMessageTags) {
+			continue
+		}
+
+		err = cli.RespondTagged(entry.Tags.WithBatch(ref), entry.Line)
+		if err != nil {
+			r.log.Err(err).Msg("cannot send message")
+		}
+	}
+
+	err = cli.EndBatch(ref)
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+}
@@ -0,0 +1,97 @@
+package room
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistorySelectors(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := NewHistory(0, 0)
+
+	// m0 to m9, one second apart
+	for i := 0; i < 10; i++ {
+		h.Add(HistoryEntry{Time: start.Add(time.Duration(i) * time.Second), MsgID: fmt.Sprintf("m%d", i)})
+	}
+
+	msgid := func(id string) Selector { return Selector{MsgID: id} }
+	at := func(d time.Duration) Selector { return Selector{Time: start.Add(d)} }
+
+	tests := []struct {
+		name  string
+		query func() []HistoryEntry
+		want  []string
+	}{
+		{name: "latest", query: func() []HistoryEntry { return h.Latest(Selector{}, 3) }, want: []string{"m7", "m8", "m9"}},
+		{name: "latest after msgid", query: func() []HistoryEntry { return h.Latest(msgid("m5"), 10) }, want: []string{"m6", "m7", "m8", "m9"}},
+		{name: "latest after timestamp", query: func() []HistoryEntry { return h.Latest(at(7*time.Second), 10) }, want: []string{"m8", "m9"}},
+		{name: "latest after unknown msgid", query: func() []HistoryEntry { return h.Latest(msgid("nope"), 10) }},
+
+		{name: "before msgid", query: func() []HistoryEntry { return h.Before(msgid("m5"), 2) }, want: []string{"m3", "m4"}},
+		{name: "before timestamp", query: func() []HistoryEntry { return h.Before(at(2*time.Second), 10) }, want: []string{"m0", "m1"}},
+		{name: "before timestamp between messages", query: func() []HistoryEntry { return h.Before(at(1500*time.Millisecond), 10) }, want: []string{"m0", "m1"}},
+		{name: "before the first", query: func() []HistoryEntry { return h.Before(msgid("m0"), 10) }},
+		{name: "before unknown msgid", query: func() []HistoryEntry { return h.Before(msgid("nope"), 10) }},
+
+		{name: "after msgid", query: func() []HistoryEntry { return h.After(msgid("m5"), 2) }, want: []string{"m6", "m7"}},
+		{name: "after timestamp", query: func() []HistoryEntry { return h.After(at(7*time.Second), 10) }, want: []string{"m8", "m9"}},
+		{name: "after the last", query: func() []HistoryEntry { return h.After(msgid("m9"), 10) }},
+		{name: "after unknown msgid", query: func() []HistoryEntry { return h.After(msgid("nope"), 10) }},
+
+		{name: "around msgid", query: func() []HistoryEntry { return h.Around(msgid("m5"), 4) }, want: []string{"m3", "m4", "m5", "m6"}},
+		{name: "around timestamp", query: func() []HistoryEntry { return h.Around(at(5*time.Second), 2) }, want: []string{"m4", "m5"}},
+		{name: "around the first", query: func() []HistoryEntry { return h.Around(msgid("m0"), 4) }, want: []string{"m0", "m1", "m2", "m3"}},
+		{name: "around the last", query: func() []HistoryEntry { return h.Around(msgid("m9"), 4) }, want: []string{"m6", "m7", "m8", "m9"}},
+		{name: "around unknown msgid", query: func() []HistoryEntry { return h.Around(msgid("nope"), 4) }},
+
+		{name: "between msgids", query: func() []HistoryEntry { return h.Between(msgid("m2"), msgid("m6"), 10) }, want: []string{"m3", "m4", "m5"}},
+		{name: "between timestamps", query: func() []HistoryEntry { return h.Between(at(2*time.Second), at(6*time.Second), 10) }, want: []string{"m3", "m4", "m5"}},
+		{name: "between msgid and timestamp", query: func() []HistoryEntry { return h.Between(msgid("m2"), at(6*time.Second), 10) }, want: []string{"m3", "m4", "m5"}},
+		{name: "between reversed", query: func() []HistoryEntry { return h.Between(msgid("m6"), msgid("m2"), 10) }, want: []string{"m3", "m4", "m5"}},
+		{name: "between limited from the start", query: func() []HistoryEntry { return h.Between(msgid("m2"), msgid("m6"), 2) }, want: []string{"m3", "m4"}},
+		{name: "between reversed limited from the start", query: func() []HistoryEntry { return h.Between(msgid("m6"), msgid("m2"), 2) }, want: []string{"m4", "m5"}},
+		{name: "between adjacent", query: func() []HistoryEntry { return h.Between(msgid("m4"), msgid("m5"), 10) }},
+		{name: "between the same", query: func() []HistoryEntry { return h.Between(msgid("m4"), msgid("m4"), 10) }},
+		{name: "between unknown msgid", query: func() []HistoryEntry { return h.Between(msgid("m2"), msgid("nope"), 10) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			for _, entry := range tt.query() {
+				got = append(got, entry.MsgID)
+			}
+
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		text string
+		want Selector
+		err  error
+	}{
+		{text: "*", want: Selector{}},
+		{text: "msgid=abc", want: Selector{MsgID: "abc"}},
+		{text: "timestamp=2024-01-01T12:00:00.000Z", want: Selector{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}},
+		{text: "timestamp=yesterday", err: ErrBadSelector},
+		{text: "msgid=", err: ErrBadSelector},
+		{text: "abc", err: ErrBadSelector},
+		{text: "nick=abc", err: ErrBadSelector},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			sel, err := ParseSelector(tt.text)
+			require.ErrorIs(t, err, tt.err)
+			require.True(t, tt.want.Time.Equal(sel.Time))
+			require.Equal(t, tt.want.MsgID, sel.MsgID)
+		})
+	}
+}
@@ -0,0 +1,434 @@
+package room
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simplefxn/goircd/pkg/v2/server/client"
+	"github.com/simplefxn/goircd/pkg/v2/server/mask"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
+)
+
+// Privilege held by a member inside a room. Flags are independent, a member
+// can be voiced and operator at the same time.
+type Privilege uint8
+
+const (
+	PrivilegeVoice Privilege = 1 << iota
+	PrivilegeOp
+
+	// Privilege modes and their prefixes, as in PREFIX of ISUPPORT
+	PrivilegeModes    = "ov"
+	PrivilegePrefixes = "@+"
+)
+
+// Room modes that are simply set or unset, without any argument.
+const (
+	ModeInviteOnly = 'i'
+	ModeModerated  = 'm'
+	ModeNoExternal = 'n'
+	ModePrivate    = 'p'
+	ModeSecret     = 's'
+	ModeTopicLock  = 't'
+
+	FlagModes = "imnpst"
+)
+
+// Room modes holding lists of nick!user@host masks.
+const (
+	ModeBan          = 'b'
+	ModeExcept       = 'e'
+	ModeInviteExcept = 'I'
+
+	ListModes      = "beI"
+	MaxListEntries = 100
+)
+
+// Modes with an argument changed by a single MODE command at most, as in
+// MODES of ISUPPORT. The rest is ignored.
+const MaxModeChanges = 4
+
+// Reply numerics for each mask list: entry, end of list and its text.
+var listNumerics = map[rune][3]string{
+	ModeBan:          {"367", "368", "End of channel ban list"},
+	ModeExcept:       {"348", "349", "End of channel exception list"},
+	ModeInviteExcept: {"346", "347", "End of channel invite list"},
+}
+
+// Mask entry of a ban, exception or invite exception list.
+type ListEntry struct {
+	SetAt time.Time
+	Mask  string
+	SetBy string
+}
+
+// NAMES/WHO prefix for the highest privilege held.
+func (p Privilege) Prefix() string {
+	switch {
+	case p&PrivilegeOp != 0:
+		return "@"
+	case p&PrivilegeVoice != 0:
+		return "+"
+	default:
+		return ""
+	}
+}
+
+// Find a member of the room by its nickname.
+func (r *Room) Member(nickname string) *client.Client {
+	for member := range r.Members {
+		if strings.EqualFold(member.Nickname(), nickname) {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// Check whether cli is an operator of the room.
+func (r *Room) IsOp(cli *client.Client) bool {
+	return r.Members[cli]&PrivilegeOp != 0
+}
+
+// Check whether a flag mode such as ModeSecret is set.
+func (r *Room) Flag(mode rune) bool {
+	return r.Flags[mode]
+}
+
+// Check whether the room is hidden from cli in LIST, WHOIS and alike.
+func (r *Room) HiddenFrom(cli *client.Client) bool {
+	_, subscribed := r.Members[cli]
+
+	return !subscribed && (r.Flag(ModeSecret) || r.Flag(ModePrivate))
+}
+
+// Check whether any entry of the mask list matches cli.
+func (r *Room) Listed(mode rune, cli *client.Client) bool {
+	for _, entry := range r.Lists[mode] {
+		if mask.Match(entry.Mask, cli.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check whether cli is banned and not covered by an exception.
+func (r *Room) Banned(cli *client.Client) bool {
+	return r.Listed(ModeBan, cli) && !r.Listed(ModeExcept, cli)
+}
+
+// Send entries of the mask list to cli.
+func (r *Room) SendMaskList(cli *client.Client, mode rune) {
+	numerics := listNumerics[mode]
+
+	for _, entry := range r.Lists[mode] {
+		err := cli.ReplyNicknamed(numerics[0], r.Name, entry.Mask, entry.SetBy, strconv.FormatInt(entry.SetAt.Unix(), 10))
+		if err != nil {
+			r.log.Err(err).Msg("cannot send message")
+		}
+	}
+
+	err := cli.ReplyNicknamed(numerics[1], r.Name, numerics[2])
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Add mask to the list, reporting whether it was not there yet.
+func (r *Room) addMask(mode rune, entry ListEntry) bool {
+	for _, e := range r.Lists[mode] {
+		if strings.EqualFold(e.Mask, entry.Mask) {
+			return false
+		}
+	}
+
+	r.Lists[mode] = append(r.Lists[mode], entry)
+
+	return true
+}
+
+// Remove mask from the list, reporting whether it was there.
+func (r *Room) removeMask(mode rune, m string) bool {
+	for i, e := range r.Lists[mode] {
+		if strings.EqualFold(e.Mask, m) {
+			r.Lists[mode] = append(r.Lists[mode][:i], r.Lists[mode][i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Recognize a bare list query such as "b" or "+e" in MODE parameters.
+func listQuery(args []string) (rune, bool) {
+	if len(args) != 1 {
+		return 0, false
+	}
+
+	modes := strings.TrimLeft(args[0], "+-")
+	if len(modes) != 1 || !strings.Contains(ListModes, modes) {
+		return 0, false
+	}
+
+	return rune(modes[0]), true
+}
+
+// Check whether cli may join the room with the given key. Numeric and text
+// of the error reply are returned, empty code means cli is welcome.
+// A pending invitation lets cli pass +i and +k. Only the room goroutine
+// may call it, so that nothing changes before cli is added.
+func (r *Room) JoinDenied(cli *client.Client, key string) (code, reason string) {
+	invited := r.Invited(cli)
+
+	switch {
+	case r.Banned(cli):
+		return "474", "Cannot join channel (+b)"
+	case r.Flag(ModeInviteOnly) && !invited && !r.Listed(ModeInviteExcept, cli):
+		return "473", "Cannot join channel (+i)"
+	case r.Limit > 0 && len(r.Members) >= r.Limit:
+		return "471", "Cannot join channel (+l)"
+	case r.Key != "" && r.Key != key && !invited:
+		return "475", "Cannot join channel (+k) - bad key"
+	}
+
+	return "", ""
+}
+
+// Check whether cli may talk in the room, honouring +n, +m and bans.
+// Voiced members and operators may talk even when banned.
+func (r *Room) CanSend(cli *client.Client) bool {
+	privilege, subscribed := r.Members[cli]
+	if !subscribed && r.Flag(ModeNoExternal) {
+		return false
+	}
+
+	if privilege == 0 && r.Banned(cli) {
+		return false
+	}
+
+	return !r.Flag(ModeModerated) || privilege != 0
+}
+
+// Check whether cli may change the topic, honouring +t.
+func (r *Room) CanChangeTopic(cli *client.Client) bool {
+	return !r.Flag(ModeTopicLock) || r.IsOp(cli)
+}
+
+// Channel type character of the 353 reply.
+func (r *Room) NamesType() string {
+	switch {
+	case r.Flag(ModeSecret):
+		return "@"
+	case r.Flag(ModePrivate):
+		return "*"
+	default:
+		return "="
+	}
+}
+
+// Current room modes and their arguments as sent in 324 reply.
+func (r *Room) Modes() []string {
+	mode := "+"
+	args := []string{}
+
+	for _, c := range FlagModes {
+		if r.Flag(c) {
+			mode += string(c)
+		}
+	}
+
+	if r.Key != "" {
+		mode += "k"
+		args = append(args, r.Key)
+	}
+
+	if r.Limit > 0 {
+		mode += "l"
+		args = append(args, strconv.Itoa(r.Limit))
+	}
+
+	return append([]string{mode}, args...)
+}
+
+// Apply a MODE change such as "+ntl-v 50 bob", given as its parameters,
+// issued by cli and broadcast what was actually changed. Caller must check
+// privileges.
+func (r *Room) ChangeModes(cli *client.Client, args []string) {
+	modes, args := args[0], args[1:]
+
+	adding := true
+	applied := ""
+	appliedArgs := []string{}
+	sign := byte(0)
+	changes := 0
+
+	nextArg := func() (string, bool) {
+		if len(args) == 0 {
+			return "", false
+		}
+
+		arg := args[0]
+		args = args[1:]
+
+		return arg, true
+	}
+
+	for _, c := range modes {
+		if strings.ContainsRune(ListModes+PrivilegeModes, c) || adding && (c == 'k' || c == 'l') {
+			if changes == MaxModeChanges {
+				continue
+			}
+
+			changes++
+		}
+
+		switch c {
+		case '+':
+			adding = true
+			continue
+		case '-':
+			adding = false
+			continue
+		case 'k':
+			if adding {
+				key, ok := nextArg()
+				if !ok {
+					err := cli.ReplyNotEnoughParameters("MODE")
+					if err != nil {
+						r.log.Err(err).Msg("cannot send message")
+					}
+
+					continue
+				}
+
+				r.Key = key
+				appliedArgs = append(appliedArgs, key)
+			} else {
+				// Key argument of -k is optional and ignored
+				nextArg()
+
+				r.Key = ""
+			}
+		case 'l':
+			if adding {
+				arg, ok := nextArg()
+				if !ok {
+					err := cli.ReplyNotEnoughParameters("MODE")
+					if err != nil {
+						r.log.Err(err).Msg("cannot send message")
+					}
+
+					continue
+				}
+
+				limit, err := strconv.Atoi(arg)
+				if err != nil || limit < 1 {
+					err = cli.ReplyNicknamed("696", r.Name, "l", arg, "Invalid limit")
+					if err != nil {
+						r.log.Err(err).Msg("cannot send message")
+					}
+
+					continue
+				}
+
+				r.Limit = limit
+				appliedArgs = append(appliedArgs, arg)
+			} else {
+				r.Limit = 0
+			}
+		case ModeBan, ModeExcept, ModeInviteExcept:
+			arg, ok := nextArg()
+			if !ok {
+				r.SendMaskList(cli, c)
+
+				continue
+			}
+
+			m := mask.Normalize(arg)
+
+			if adding {
+				if len(r.Lists[c]) >= MaxListEntries {
+					err := cli.ReplyNicknamed("478", r.Name, m, "Channel list is full")
+					if err != nil {
+						r.log.Err(err).Msg("cannot send message")
+					}
+
+					continue
+				}
+
+				if !r.addMask(c, ListEntry{Mask: m, SetBy: cli.String(), SetAt: time.Now()}) {
+					continue
+				}
+			} else if !r.removeMask(c, m) {
+				continue
+			}
+
+			appliedArgs = append(appliedArgs, m)
+		case 'o', 'v':
+			nickname, ok := nextArg()
+			if !ok {
+				err := cli.ReplyNotEnoughParameters("MODE")
+				if err != nil {
+					r.log.Err(err).Msg("cannot send message")
+				}
+
+				continue
+			}
+
+			member := r.Member(nickname)
+			if member == nil {
+				err := cli.ReplyNicknamed("441", nickname, r.Name, "They aren't on that channel")
+				if err != nil {
+					r.log.Err(err).Msg("cannot send message")
+				}
+
+				continue
+			}
+
+			privilege := PrivilegeVoice
+			if c == 'o' {
+				privilege = PrivilegeOp
+			}
+
+			if adding {
+				r.Members[member] |= privilege
+			} else {
+				r.Members[member] &^= privilege
+			}
+
+			appliedArgs = append(appliedArgs, member.Nickname())
+		default:
+			if strings.ContainsRune(FlagModes, c) {
+				r.Flags[c] = adding
+
+				break
+			}
+
+			err := cli.ReplyNicknamed("472", string(c), "is unknown mode char to me")
+			if err != nil {
+				r.log.Err(err).Msg("cannot send message")
+			}
+
+			continue
+		}
+
+		if adding && sign != '+' {
+			sign = '+'
+			applied += "+"
+		} else if !adding && sign != '-' {
+			sign = '-'
+			applied += "-"
+		}
+
+		applied += string(c)
+	}
+
+	if applied == "" {
+		return
+	}
+
+	r.Broadcast(message.New(cli.String(), "MODE", append([]string{r.Name, applied}, appliedArgs...)...).String())
+}
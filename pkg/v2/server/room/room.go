@@ -6,29 +6,68 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/simplefxn/goircd/internal/pipeline"
+	"github.com/simplefxn/goircd/pkg/v2/server/caps"
 	"github.com/simplefxn/goircd/pkg/v2/server/client"
 	config "github.com/simplefxn/goircd/pkg/v2/server/config"
+	"github.com/simplefxn/goircd/pkg/v2/server/message"
 
 	"github.com/rs/zerolog"
 )
 
+const (
+	NameMaxLength   = 200 // Max length of room name without "#"
+	TopicMaxLength  = 390
+	NamesLineLength = 400 // Max length of nicknames sent in a single 353
+
+	InviteTimeout = time.Hour // Time an invitation stays usable
+
+	CapInviteNotify = "invite-notify"
+)
+
 var (
-	ReRoom = regexp.MustCompile("^#[^\x00\x07\x0a\x0d ,:/]{1,200}$")
+	ReRoom = regexp.MustCompile(fmt.Sprintf("^#[^\x00\x07\x0a\x0d ,:/]{1,%d}$", NameMaxLength))
 )
 
+func init() {
+	caps.Register(CapInviteNotify, "")
+}
+
+// Room name with ASCII letters lowercased, CASEMAPPING=ascii. Rooms whose
+// names fold the same are one room.
+func Fold(name string) string {
+	return strings.Map(func(c rune) rune {
+		if c >= 'A' && c <= 'Z' {
+			return c + 'a' - 'A'
+		}
+
+		return c
+	}, name)
+}
+
 type Room struct {
+	// Guards the state below while the room goroutine changes it, the
+	// server looks at it through the methods saying they are safe to use
+	mu         sync.RWMutex
 	pipe       pipeline.Pipeline
 	config     *config.Bootstrap
 	log        *zerolog.Logger
 	stop       chan bool
-	Members    map[*client.Client]bool
+	Members    map[*client.Client]Privilege
+	Flags      map[rune]bool
+	Lists      map[rune][]ListEntry
+	Invites    map[*client.Client]time.Time
+	History    *History
 	events     chan client.Event
+	issuer     *client.Client // Client whose event is being handled
 	Name       string
 	Topic      string
 	Key        string
+	Limit      int
 	hostname   string
 	isStarted  bool
 	natsConfig *config.NatsChannel
@@ -79,7 +118,10 @@ func New(opts ...Option) (*Room, error) {
 
 	proc := &Room{
 		stop:    make(chan bool),
-		Members: make(map[*client.Client]bool),
+		Members: make(map[*client.Client]Privilege),
+		Flags:   map[rune]bool{ModeNoExternal: true, ModeTopicLock: true},
+		Lists:   make(map[rune][]ListEntry),
+		Invites: make(map[*client.Client]time.Time),
 	}
 
 	for _, o := range opts {
@@ -90,6 +132,8 @@ func New(opts ...Option) (*Room, error) {
 		return nil, fmt.Errorf("cannot start room without a configuration")
 	}
 
+	proc.History = NewHistory(proc.config.History.Size, proc.config.History.MaxAge)
+
 	if proc.natsConfig != nil {
 		proc.nc, err = nats.Connect(proc.natsConfig.URL)
 		if err != nil {
@@ -98,6 +142,9 @@ func New(opts ...Option) (*Room, error) {
 
 		if (*proc.natsConfig).Direction == "input" {
 			proc.nc.Subscribe(proc.natsConfig.Name, func(msg *nats.Msg) {
+				proc.mu.RLock()
+				defer proc.mu.RUnlock()
+
 				proc.Broadcast(string(msg.Data))
 			})
 		}
@@ -110,8 +157,6 @@ func New(opts ...Option) (*Room, error) {
 }
 
 func (r *Room) Start(ctx context.Context) error {
-	var cli *client.Client
-
 	r.isStarted = true
 	r.log.Info().Dict("details", zerolog.Dict().Str("name", r.Name)).Msg("started")
 
@@ -122,156 +167,307 @@ func (r *Room) Start(ctx context.Context) error {
 		case <-r.stop:
 			return nil
 		case ev := <-r.events:
-			cli = ev.Client
-
 			r.log.Debug().Dict("details",
 				zerolog.Dict().
 					Str("type", ev.EventType.String()).
-					Str("text", ev.Text).
+					Str("text", ev.Message.String()).
 					Str("remote", ev.Client.RemoteHost),
 			).Msg("room received event")
 
-			switch ev.EventType {
-			case client.EventNew:
-				r.Members[cli] = true
+			r.mu.Lock()
+			r.issuer = ev.Client
+			err := r.handle(ev)
+			r.issuer = nil
+			r.mu.Unlock()
 
-				r.SendTopic(cli)
-				r.Broadcast(fmt.Sprintf(":%s JOIN %s", cli, r.Name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
 
-				nicknames := []string{}
-				for member := range r.Members {
-					nicknames = append(nicknames, member.Nickname)
-				}
+// Handle an event sent to the room. The caller holds r.mu, so the server
+// never sees the room halfway through a change.
+func (r *Room) handle(ev client.Event) error {
+	cli := ev.Client
 
-				sort.Strings(nicknames)
+	switch ev.EventType {
+	case client.EventNew:
+		if _, subscribed := r.Members[cli]; subscribed {
+			return nil
+		}
 
-				err := cli.ReplyNicknamed("353", "=", r.Name, strings.Join(nicknames, " "))
-				if err != nil {
-					return err
-				}
+		// Checked here, as the room may change until the event arrives
+		key := ev.Message.Param(1)
+		if code, reason := r.JoinDenied(cli, key); code != "" {
+			err := cli.ReplyNicknamed(code, r.Name, reason)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		var privilege Privilege
+
+		// Whoever brings a room to life becomes its operator and may lock
+		// it with the key given. NATS rooms are created by the server
+		// itself and have no founder.
+		if len(r.Members) == 0 && r.natsConfig == nil {
+			privilege = PrivilegeOp
+			r.Key = key
+		}
+
+		r.Members[cli] = privilege
+		delete(r.Invites, cli)
 
-				err = cli.ReplyNicknamed("366", r.Name, "End of NAMES list")
+		r.SendTopic(cli)
+		r.Broadcast(message.New(cli.String(), "JOIN", r.Name).String())
+
+		if cli.IsAway() {
+			for member := range r.Members {
+				err := cli.SendAwayNotify(member)
 				if err != nil {
-					return err
+					r.log.Err(err).Msg("cannot send message")
 				}
+			}
+		}
 
-			case client.EventDel:
-				if _, subscribed := r.Members[cli]; !subscribed {
-					err := cli.ReplyNicknamed("442", r.Name, "You are not on that channel")
-					if err != nil {
-						return err
-					}
+		r.SendNames(cli)
 
-					continue
-				}
+		// Clients with chathistory fetch what they need themselves
+		if replay := r.config.History.Replay; replay > 0 && !cli.Caps.Has(CapChatHistory) {
+			if entries := r.History.Latest(Selector{}, replay); len(entries) > 0 {
+				r.SendHistory(cli, entries)
+			}
+		}
 
-				delete(r.Members, cli)
+	case client.EventDel:
+		if _, subscribed := r.Members[cli]; !subscribed {
+			err := cli.ReplyNotOnChannel(r.Name)
+			if err != nil {
+				return err
+			}
 
-				msg := fmt.Sprintf(":%s PART %s :%s", cli, r.Name, cli.Nickname)
+			return nil
+		}
 
-				go r.Broadcast(msg)
+		delete(r.Members, cli)
 
-			case client.EventTopic:
-				if _, subscribed := r.Members[cli]; !subscribed {
-					err := cli.ReplyParts("442", r.Name, "You are not on that channel")
-					if err != nil {
-						return err
-					}
+		reason := ev.Message.Param(1)
+		if reason == "" {
+			reason = cli.Nickname()
+		}
 
-					continue
-				}
+		r.Broadcast(message.New(cli.String(), "PART", r.Name, reason).String())
 
-				if ev.Text == "" {
-					go r.SendTopic(cli)
+	case client.EventTopic:
+		if _, subscribed := r.Members[cli]; !subscribed {
+			err := cli.ReplyNotOnChannel(r.Name)
+			if err != nil {
+				return err
+			}
 
-					continue
-				}
+			return nil
+		}
 
-				r.Topic = strings.TrimLeft(ev.Text, ":")
+		// "TOPIC #room" asks for the topic, "TOPIC #room :" clears it
+		if len(ev.Message.Params) < 2 {
+			r.SendTopic(cli)
 
-				msg := fmt.Sprintf(":%s TOPIC %s :%s", cli, r.Name, r.Topic)
-				go r.Broadcast(msg)
+			return nil
+		}
 
-			case client.EventWho:
-				for m := range r.Members {
-					err := cli.ReplyNicknamed("352", r.Name, m.Username, m.RemoteHost, r.hostname, m.Nickname, "H", "0 "+m.Realname)
-					if err != nil {
-						return err
-					}
-				}
+		if !r.CanChangeTopic(cli) {
+			err := cli.ReplyChanOpPrivsNeeded(r.Name)
+			if err != nil {
+				return err
+			}
 
-				err := cli.ReplyNicknamed("315", r.Name, "End of /WHO list")
-				if err != nil {
-					return err
-				}
+			return nil
+		}
 
-			case client.EventMode:
-				if ev.Text == "" {
-					mode := "+"
-					if r.Key != "" {
-						mode += "k"
-					}
+		r.Topic = ev.Message.Params[1]
+		if len(r.Topic) > TopicMaxLength {
+			r.Topic = r.Topic[:TopicMaxLength]
+		}
 
-					err := cli.Msg(fmt.Sprintf("324 %s %s %s", cli.Nickname, r.Name, mode))
-					if err != nil {
-						return err
-					}
+		r.Broadcast(message.New(cli.String(), "TOPIC", r.Name, r.Topic).String())
 
-					continue
-				}
+	case client.EventKick:
+		if _, subscribed := r.Members[cli]; !subscribed {
+			err := cli.ReplyNotOnChannel(r.Name)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
 
-				if strings.HasPrefix(ev.Text, "-k") || strings.HasPrefix(ev.Text, "+k") {
-					if _, subscribed := r.Members[cli]; !subscribed {
-						err := cli.ReplyParts("442", r.Name, "You are not on that channel")
-						if err != nil {
-							return err
-						}
+		if !r.IsOp(cli) {
+			err := cli.ReplyChanOpPrivsNeeded(r.Name)
+			if err != nil {
+				return err
+			}
 
-						continue
-					}
-				} else {
-					err := cli.ReplyNicknamed("472", ev.Text, "Unknown MODE flag")
+			return nil
+		}
 
-					if err != nil {
-						return err
-					}
+		r.Kick(cli, ev.Message.Param(1), ev.Message.Param(2))
 
-					continue
-				}
+	case client.EventInvite:
+		if _, subscribed := r.Members[cli]; !subscribed {
+			err := cli.ReplyNotOnChannel(r.Name)
+			if err != nil {
+				return err
+			}
 
-				var msg string
+			return nil
+		}
 
-				if strings.HasPrefix(ev.Text, "+k") {
-					cols := strings.Split(ev.Text, " ")
-					if len(cols) == 1 {
-						err := cli.ReplyNotEnoughParameters("MODE")
-						if err != nil {
-							return err
-						}
+		if r.Flag(ModeInviteOnly) && !r.IsOp(cli) {
+			err := cli.ReplyChanOpPrivsNeeded(r.Name)
+			if err != nil {
+				return err
+			}
 
-						continue
-					}
+			return nil
+		}
 
-					r.Key = cols[1]
-					msg = fmt.Sprintf(":%s MODE %s +k %s", cli, r.Name, r.Key)
-				} else if strings.HasPrefix(ev.Text, "-k") {
-					r.Key = ""
-					msg = fmt.Sprintf(":%s MODE %s -k", cli, r.Name)
-				}
+		if _, subscribed := r.Members[ev.Target]; subscribed {
+			err := cli.ReplyNicknamed("443", ev.Target.Nickname(), r.Name, "is already on channel")
+			if err != nil {
+				return err
+			}
 
-				go r.Broadcast(msg)
+			return nil
+		}
 
-			case client.EventMsg:
-				sep := strings.Index(ev.Text, " ")
-				r.log.Info().Dict("details", zerolog.Dict().Str("client", cli.RemoteHost)).Msg(ev.Text)
-				r.Broadcast(fmt.Sprintf(":%s %s %s :%s", cli, ev.Text[:sep], r.Name, ev.Text[sep+1:]), cli)
+		r.Invite(cli, ev.Target)
 
-				if r.nc != nil {
-					r.nc.Publish(r.Name, []byte(ev.Text[sep+1:]))
-				}
+	case client.EventQuit:
+		// Server has already told everybody
+		delete(r.Members, cli)
+		delete(r.Invites, cli)
+
+	case client.EventNames:
+		// NAMES without parameters goes through every room, the server
+		// ends the whole list with a single 366
+		if ev.Message.Param(0) == "" {
+			if !r.HiddenFrom(cli) {
+				r.SendNamesReplies(cli)
+			}
+
+			return nil
+		}
+
+		r.SendNames(cli)
+
+	case client.EventWho:
+		_, subscribed := r.Members[cli]
+
+		for m, privilege := range r.Members {
+			// Same visibility rules as for NAMES
+			if r.HiddenFrom(cli) || m.Invisible() && !subscribed {
+				continue
+			}
+
+			err := cli.ReplyNicknamed("352", r.Name, m.Username, m.Host(), r.hostname, m.Nickname(), m.WhoFlag()+privilege.Prefix(), "0 "+m.Realname)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := cli.ReplyNicknamed("315", r.Name, "End of /WHO list")
+		if err != nil {
+			return err
+		}
+
+	case client.EventMode:
+		args := ev.Message.Params[1:]
+		if len(args) == 0 {
+			err := cli.ReplyNicknamed("324", append([]string{r.Name}, r.Modes()...)...)
+			if err != nil {
+				return err
 			}
+
+			return nil
+		}
+
+		// Anybody may look at mask lists, e.g. "MODE #chan b"
+		if mode, ok := listQuery(args); ok {
+			r.SendMaskList(cli, mode)
+
+			return nil
+		}
+
+		if _, subscribed := r.Members[cli]; !subscribed {
+			err := cli.ReplyNotOnChannel(r.Name)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		if !r.IsOp(cli) {
+			err := cli.ReplyChanOpPrivsNeeded(r.Name)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		r.ChangeModes(cli, args)
+
+	case client.EventMsg:
+		command, text := ev.Message.Command, ev.Message.Param(1)
+
+		if !r.CanSend(cli) {
+			// Only PRIVMSG may trigger automatic replies
+			if command != "PRIVMSG" {
+				return nil
+			}
+
+			err := cli.ReplyNicknamed("404", r.Name, "Cannot send to channel")
+			if err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		// History is addressed with millisecond timestamps clients saw
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		tags := ev.Message.Tags.WithTime(now).WithMsgID()
+
+		if command == "TAGMSG" {
+			msg := message.New(cli.String(), "TAGMSG", r.Name).String()
+			r.BroadcastTagOnly(tags, msg, cli)
+			r.History.Add(HistoryEntry{Time: now, Tags: tags, MsgID: tags[message.TagMsgID], Line: msg, TagOnly: true})
+
+			if cli.Caps.Has(client.CapMessageTags) {
+				r.Echo(cli, tags, msg)
+			}
+
+			return nil
+		}
+
+		r.log.Info().Dict("details", zerolog.Dict().Str("client", cli.RemoteHost)).Msg(command + " " + text)
+
+		msg := message.New(cli.String(), command, r.Name, text).String()
+		r.BroadcastTagged(tags, msg, cli)
+		r.History.Add(HistoryEntry{Time: now, Tags: tags, MsgID: tags[message.TagMsgID], Line: msg})
+		r.Echo(cli, tags, msg)
+
+		if r.nc != nil {
+			r.nc.Publish(r.Name, []byte(text))
 		}
 	}
+
+	return nil
 }
 
 func (r *Room) Stop(ctx context.Context) error {
@@ -283,6 +479,88 @@ func (r *Room) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Record invitation of target made by inviter and let everybody concerned
+// know: the inviter, the target and members which negotiated
+// invite-notify. Operators of the room without it get a NOTICE.
+func (r *Room) Invite(inviter, target *client.Client) {
+	now := time.Now()
+
+	for invited, at := range r.Invites {
+		if at.Add(InviteTimeout).Before(now) {
+			delete(r.Invites, invited)
+		}
+	}
+
+	r.Invites[target] = now
+
+	err := inviter.ReplyNicknamed("341", target.Nickname(), r.Name)
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+
+	msg := message.New(inviter.String(), "INVITE", target.Nickname(), r.Name).String()
+	tags := message.Tags{}.WithTime(now)
+
+	err = r.send(target, tags, msg)
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+
+	// INVITE line means an invitation to whoever gets it, unless the
+	// client negotiated invite-notify. Other operators get a NOTICE.
+	notice := message.New(r.hostname, "NOTICE", r.Name, inviter.Nickname()+" invited "+target.Nickname()+" into the channel").String()
+
+	for member := range r.Members {
+		if member == inviter || member == target {
+			continue
+		}
+
+		switch {
+		case member.Caps.Has(CapInviteNotify):
+			err = r.send(member, tags, msg)
+		case r.IsOp(member):
+			err = r.send(member, tags, notice)
+		default:
+			continue
+		}
+
+		if err != nil {
+			r.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
+
+// Check whether cli holds a pending invitation.
+func (r *Room) Invited(cli *client.Client) bool {
+	at, found := r.Invites[cli]
+
+	return found && time.Since(at) < InviteTimeout
+}
+
+// Remove members listed in comma separated nicknames on behalf of kicker.
+// Everybody, the kicked ones included, sees the KICK before removal.
+func (r *Room) Kick(kicker *client.Client, nicknames, reason string) {
+	if reason == "" {
+		reason = kicker.Nickname()
+	}
+
+	for _, nickname := range strings.Split(nicknames, ",") {
+		target := r.Member(nickname)
+		if target == nil {
+			err := kicker.ReplyNicknamed("441", nickname, r.Name, "They aren't on that channel")
+			if err != nil {
+				r.log.Err(err).Msg("cannot send message")
+			}
+
+			continue
+		}
+
+		r.Broadcast(message.New(kicker.String(), "KICK", r.Name, target.Nickname(), reason).String())
+
+		delete(r.Members, target)
+	}
+}
+
 func (r *Room) SendTopic(cli *client.Client) {
 	if r.Topic == "" {
 		err := cli.ReplyNicknamed("331", r.Name, "No Topic is set")
@@ -298,19 +576,165 @@ func (r *Room) SendTopic(cli *client.Client) {
 }
 
 func (r *Room) Broadcast(msg string, clientToIgnore ...*client.Client) {
+	r.BroadcastTagged(message.Tags{}, msg, clientToIgnore...)
+}
+
+// Broadcast message with tags and the current server time attached, unless
+// tags carry time already. Each member gets only the tags it negotiated.
+func (r *Room) BroadcastTagged(tags message.Tags, msg string, clientToIgnore ...*client.Client) {
+	if _, found := tags[message.TagTime]; !found {
+		tags = tags.WithTime(time.Now())
+	}
+
 	for member := range r.Members {
 		if (len(clientToIgnore) > 0) && member == clientToIgnore[0] {
 			continue
 		}
 
-		err := member.Msg(msg)
+		err := r.send(member, tags, msg)
 		if err != nil {
 			r.log.Err(err).Msg("cannot send message")
 		}
 	}
 }
 
-// Sanitize room's name. It can consist of 1 to 50 ASCII symbols
+// Broadcast TAGMSG style message to members which negotiated message-tags,
+// others would get nothing but an empty line.
+func (r *Room) BroadcastTagOnly(tags message.Tags, msg string, clientToIgnore ...*client.Client) {
+	if _, found := tags[message.TagTime]; !found {
+		tags = tags.WithTime(time.Now())
+	}
+
+	for member := range r.Members {
+		if (len(clientToIgnore) > 0 && member == clientToIgnore[0]) || !member.Caps.Has(client.CapMessageTags) {
+			continue
+		}
+
+		err := r.send(member, tags, msg)
+		if err != nil {
+			r.log.Err(err).Msg("cannot send message")
+		}
+	}
+}
+
+// Send message to a member. The client whose event is being handled gets
+// it as part of the response to its command, everybody else as usual.
+func (r *Room) send(member *client.Client, tags message.Tags, msg string) error {
+	if member == r.issuer {
+		return member.RespondTagged(tags, msg)
+	}
+
+	return member.MsgTagged(tags, msg)
+}
+
+// Send 353 with members visible to cli, followed by 366.
+func (r *Room) SendNames(cli *client.Client) {
+	r.SendNamesReplies(cli)
+
+	err := cli.ReplyNicknamed("366", r.Name, "End of NAMES list")
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Send 353 with members visible to cli. Secret and private rooms show
+// nobody to outsiders, invisible members are shown only to those sharing
+// the room.
+func (r *Room) SendNamesReplies(cli *client.Client) {
+	_, subscribed := r.Members[cli]
+
+	nicknames := []string{}
+
+	if !r.HiddenFrom(cli) {
+		for member, privilege := range r.Members {
+			if member.Invisible() && !subscribed {
+				continue
+			}
+
+			nicknames = append(nicknames, privilege.Prefix()+member.Nickname())
+		}
+	}
+
+	sort.Strings(nicknames)
+
+	for len(nicknames) > 0 {
+		n, length := 0, 0
+		for n < len(nicknames) && (n == 0 || length+len(nicknames[n])+1 <= NamesLineLength) {
+			length += len(nicknames[n]) + 1
+			n++
+		}
+
+		err := cli.ReplyNicknamed("353", r.NamesType(), r.Name, strings.Join(nicknames[:n], " "))
+		if err != nil {
+			r.log.Err(err).Msg("cannot send message")
+		}
+
+		nicknames = nicknames[n:]
+	}
+}
+
+// Send sender's own message back to it, exactly as others got it, when it
+// negotiated echo-message.
+func (r *Room) Echo(sender *client.Client, tags message.Tags, msg string) {
+	err := sender.Echo(tags, msg)
+	if err != nil {
+		r.log.Err(err).Msg("cannot send message")
+	}
+}
+
+// Privilege of cli and whether it is a member at all. Safe to call from
+// other goroutines.
+func (r *Room) Membership(cli *client.Client) (Privilege, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	privilege, subscribed := r.Members[cli]
+
+	return privilege, subscribed
+}
+
+// Members of the room, nil unless cli is one of them. Safe to call from
+// other goroutines.
+func (r *Room) MembersSharedWith(cli *client.Client) []*client.Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, subscribed := r.Members[cli]; !subscribed {
+		return nil
+	}
+
+	members := make([]*client.Client, 0, len(r.Members))
+	for member := range r.Members {
+		members = append(members, member)
+	}
+
+	return members
+}
+
+// Check whether the room is shown to cli in WHOIS and NAMES. Safe to call
+// from other goroutines.
+func (r *Room) VisibleTo(cli *client.Client) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return !r.HiddenFrom(cli)
+}
+
+// Member count and topic shown to cli in LIST, false if the room is not
+// listed at all. Secret rooms are not listed to outsiders, private ones
+// without topic. Safe to call from other goroutines.
+func (r *Room) Listing(cli *client.Client) (int, string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.HiddenFrom(cli) {
+		return len(r.Members), r.Topic, true
+	}
+
+	return len(r.Members), "", !r.Flag(ModeSecret)
+}
+
+// Sanitize room's name. It can consist of 1 to NameMaxLength symbols
 // with some exclusions. All room names will have "#" prefix.
 func NameValid(name string) bool {
 	return ReRoom.MatchString(name)
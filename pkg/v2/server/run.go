@@ -6,6 +6,8 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/simplefxn/goircd/pkg/v2/logger"
+	"github.com/simplefxn/goircd/pkg/v2/server/account"
+	"github.com/simplefxn/goircd/pkg/v2/server/ban"
 	"github.com/simplefxn/goircd/pkg/v2/server/config"
 	"github.com/simplefxn/goircd/pkg/v2/server/ircd"
 	"github.com/urfave/cli/v2"
@@ -50,6 +52,18 @@ var flags = []cli.Flag{
 		Usage:       "path to ssl ca file",
 		Destination: &config.Get().SSLCA,
 	}),
+	altsrc.NewStringFlag(&cli.StringFlag{
+		Name:        "accounts",
+		Value:       "",
+		Usage:       "path to accounts file",
+		Destination: &config.Get().Accounts,
+	}),
+	altsrc.NewStringFlag(&cli.StringFlag{
+		Name:        "bans",
+		Value:       "",
+		Usage:       "path to file server bans are saved to",
+		Destination: &config.Get().Bans,
+	}),
 	altsrc.NewBoolFlag(&cli.BoolFlag{
 		Name:        "prettyConsole",
 		Value:       false,
@@ -77,15 +91,39 @@ func CmdRun() *cli.Command {
 				return err
 			}
 
-			server, err := ircd.New(
+			configFile, err := os.ReadFile(cCtx.String("config"))
+			if err != nil {
+				return err
+			}
+
+			err = config.Get().LoadSections(configFile)
+			if err != nil {
+				return err
+			}
+
+			opts := []ircd.ServerOption{
 				ircd.Config(config.Get()),
+				ircd.ConfigFile(cCtx.String("config")),
 				ircd.Logger(&lg),
-			)
+			}
+
+			if config.Get().Accounts != "" {
+				store, storeErr := account.NewFileStore(config.Get().Accounts)
+				if storeErr != nil {
+					return storeErr
+				}
+
+				opts = append(opts, ircd.Accounts(store))
+			}
+
+			bans, err := ban.Open(config.Get().Bans)
 			if err != nil {
 				return err
 			}
 
-			configFile, err := os.ReadFile(cCtx.String("config"))
+			opts = append(opts, ircd.Bans(bans))
+
+			server, err := ircd.New(opts...)
 			if err != nil {
 				return err
 			}